@@ -6,7 +6,9 @@
 package api
 
 import (
+	"context"
 	"image"
+	"math"
 	"time"
 )
 
@@ -14,11 +16,44 @@ import (
 // ( $GOFILE represents current file )
 //go:generate go run github.com/marben/irpc/cmd/irpc@latest $GOFILE
 
-// ImgProvider is implemented by the server and is called by the CLI client to get the full image once rendering is complete.
+// ImgProvider is implemented by the server and is called by the CLI client to get rendered images.
+// The server renders its own job (ServerJobID) and any number of jobs submitted by clients at once.
 type ImgProvider interface {
-	// GetImage returns the fully rendered image.
+	// SubmitJob starts rendering of w×h image of region and returns id of the new job.
+	SubmitJob(region MandelRegion, w, h int, params RenderParams) (JobID, error)
+	// GetImage returns the fully rendered image of job with 16 bits per channel.
 	// Blocks until rendering is finished
-	GetImage() (*image.RGBA, error)
+	GetImage(job JobID) (*image.RGBA64, error)
+	// FullImageDimensions returns the width and height of job's full image.
+	FullImageDimensions(job JobID) (width, height int, err error)
+	// Progress returns finished fraction of job's rendering, from 0 to 1.
+	Progress(job JobID) (float64, error)
+	// GetImageRows returns rows y..y+n-1 of job's image with 16 bits per channel, so that the image can be received in chunks.
+	// Blocks until the rows are rendered or ctx is cancelled. Returned image has bounds of the rows.
+	GetImageRows(ctx context.Context, job JobID, y, n int) (*image.RGBA64, error)
+	// Jobs returns status of all jobs known to the server.
+	Jobs() ([]JobStatus, error)
+	// CancelJob stops rendering of submitted job. Its workers are cancelled and its image can't be received anymore.
+	// The server's own job (ServerJobID) can't be cancelled.
+	CancelJob(job JobID) error
+}
+
+// JobID identifies a job rendered by the server.
+// Submitted jobs are forgotten some time after they are finished.
+type JobID int
+
+// ServerJobID is the id of the job the server was started with
+const ServerJobID JobID = 0
+
+// JobStatus describes a job known to the server.
+type JobStatus struct {
+	ID            JobID
+	Width, Height int
+	Progress      float64 // finished fraction, from 0 to 1
+	// Renders counts tile renders handed out to workers, including duplicates.
+	// Of those, Wasted duplicates finished after another copy and Cancelled ones were stopped by it.
+	// Jobs not split into image tiles report zeros.
+	Renders, Wasted, Cancelled int
 }
 
 // TileProvider is implemented by the server and used by the web client to show rendering progress tile by tile.
@@ -26,12 +61,15 @@ type ImgProvider interface {
 type TileProvider interface {
 	// FinishedTiles returns a map of rectangles of all finished tiles.
 	FinishedTiles() (map[image.Rectangle]struct{}, error)
-	// GetTileImg returns image of given rectangle.
+	// GetTileImg returns image of given rectangle, reduced to 8 bits per channel for display.
 	GetTileImg(rect image.Rectangle) (*image.RGBA, error)
 	// FullImageDimensions returns the width and height of the full image.
 	FullImageDimensions() (width, height int, err error)
 	// TotalTilesCount returns the total count of tiles to be rendered.
 	TotalTilesCount() (int, error)
+	// Frames returns index of the frame shown by FinishedTiles and GetTileImg and total count of frames.
+	// Jobs rendering a single image have one frame.
+	Frames() (current, total int, err error)
 	// WorkersCount returns the number of workers currently running.
 	WorkersCount() (int, error)
 }
@@ -41,8 +79,16 @@ type TileProvider interface {
 // It is implemented by all rendering clients (CLI and web) and called from the server.
 type Renderer interface {
 	// RenderTile renders a single tile of the Mandelbrot image.
+	//   ctx: cancelled by the server once the tile isn't needed anymore, e.g. when another worker rendered it first
+	//   params: coloring parameters of the job
 	//   imgW, imgH: full image width and height
-	RenderTile(reg MandelRegion, imgW, imgH int, tile image.Rectangle) (*image.RGBA, error)
+	// Returned tile has 16 bits per channel.
+	RenderTile(ctx context.Context, reg MandelRegion, params RenderParams, imgW, imgH int, tile image.Rectangle) (*image.RGBA64, error)
+	// RenderDensity samples job.Samples random points and accumulates their escaping orbits into a density grid.
+	//   seed: seed of the random generator. Calls with different seeds sample different points
+	RenderDensity(job DensityJob, seed uint64) (*DensityGrid, error)
+	// Ping is called by the server on connect. Clients that only observe (don't want to render) return an error, so they are not used as workers.
+	Ping() error
 }
 
 // RenderTileSleepTime is used by all renderers (CLI and web) to slow down rendering, so the parallelization is more apparent.
@@ -53,3 +99,104 @@ type MandelRegion struct {
 	Xmin, Xmax float64
 	Ymin, Ymax float64
 }
+
+// DensityJob describes a Buddhabrot style job.
+// Unlike tiles, where each pixel depends only on its own c, orbits of random points c
+// are accumulated over the whole grid.
+type DensityJob struct {
+	Region MandelRegion // region covered by the grid
+	W, H   int          // grid dimensions
+	// Samples is the count of random points sampled by a single RenderDensity call.
+	Samples int
+	// MinIter drops orbits escaping in fewer iterations, which would otherwise fog the whole image.
+	MinIter int
+	// MaxIters holds iteration limit of each channel. A channel counts orbits escaping within its limit.
+	// Single channel renders Buddhabrot, three channels (red, green, blue) render Nebulabrot.
+	MaxIters []int
+}
+
+// DensityGrid holds orbit hit counts of a DensityJob.
+type DensityGrid struct {
+	W, H     int
+	Channels int
+	// Hits holds non-zero counts of W*H cells row by row, for one channel after another, as pairs of uvarints:
+	// the number of zero cells skipped since the previous hit cell and the count of the cell.
+	// A unit hits only a part of the grid, so this is much smaller than all W*H*Channels counts.
+	Hits []byte
+}
+
+// TrapKind selects the shape of an orbit trap.
+type TrapKind int
+
+const (
+	TrapNone   TrapKind = iota // no trap, pure smooth iteration coloring
+	TrapPoint                  // distance to point (X, Y)
+	TrapLine                   // distance to line through (X, Y) at Angle
+	TrapCircle                 // distance to circle centered at (X, Y) with Radius
+	TrapCross                  // distance to two perpendicular lines through (X, Y) rotated by Angle
+	TrapStalks                 // Pickover stalks: distance to axes through (X, Y), scaled by Radius as stalk width
+)
+
+// OrbitTrap describes an orbit trap. Fields not used by the Kind are ignored.
+type OrbitTrap struct {
+	Kind   TrapKind
+	X, Y   float64 // center of the trap
+	Radius float64
+	Angle  float64 // in radians
+}
+
+// ColorSpace selects the color space in which gradient stops are interpolated.
+type ColorSpace int
+
+const (
+	ColorSpaceRGB   ColorSpace = iota // plain sRGB interpolation
+	ColorSpaceOKLab                   // perceptually uniform OKLab interpolation
+)
+
+// GradientStop is a color at position Pos (0..1) of a gradient.
+type GradientStop struct {
+	Pos     float64
+	R, G, B uint8
+}
+
+// Palette is a named gradient used to color smooth iteration counts.
+// Palette without stops is colored by the classic hsv sweep.
+type Palette struct {
+	Name  string
+	Stops []GradientStop
+	Space ColorSpace
+}
+
+// Mapping selects how image pixels map onto the complex plane.
+type Mapping int
+
+const (
+	// MappingLinear maps the image linearly onto MandelRegion.
+	MappingLinear Mapping = iota
+	// MappingExp is exponential (log-polar) map centered at the MandelRegion center.
+	// Image width spans the full circle, and each image width of rows down zooms in by factor e^2π.
+	// The top row is at the distance of MandelRegion corners from its center.
+	// Tall image thus covers many zoom levels at once and can be unwarped into zoom frames.
+	MappingExp
+)
+
+// RenderParams defines how a job's tiles are mapped and colored.
+type RenderParams struct {
+	Mapping Mapping
+
+	Trap OrbitTrap
+	// TrapWeight is the blend weight of the trap against the smooth iteration color.
+	TrapWeight float64
+
+	Palette Palette
+	// PaletteCycle is the number of iterations after which the palette repeats. Zero means 50.
+	PaletteCycle float64
+	// PaletteOffset shifts the palette start, in fractions of a cycle.
+	PaletteOffset float64
+}
+
+// DefaultRenderParams gives the classic look: a trap on the imaginary axis blended at 0.3.
+var DefaultRenderParams = RenderParams{
+	Trap:       OrbitTrap{Kind: TrapLine, Angle: math.Pi / 2},
+	TrapWeight: 0.3,
+}
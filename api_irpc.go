@@ -9,7 +9,7 @@ import (
 	"image"
 )
 
-var _ImgProviderIrpcId = irpcgen.ServiceId(0xd7928cd32ef6bba5)
+var _ImgProviderIrpcId = irpcgen.ServiceId(0xda4118627880c4b0)
 
 // ImgProviderIrpcService provides [ImgProvider] interface over irpc
 type ImgProviderIrpcService struct {
@@ -31,11 +31,83 @@ func (s *ImgProviderIrpcService) Id() irpcgen.ServiceId {
 // GetFuncCall implements [irpcgen.Service] interface
 func (s *ImgProviderIrpcService) GetFuncCall(funcId irpcgen.FuncId) (irpcgen.ArgDeserializer, error) {
 	switch funcId {
-	case 0: // GetImage
+	case 0: // SubmitJob
 		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_ImgProvider_SubmitJobReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_ImgProvider_SubmitJobResp
+				resp.p0, resp.p1 = s.impl.SubmitJob(args.region, args.w, args.h, args.params)
+				return resp
+			}, nil
+		}, nil
+	case 1: // GetImage
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_ImgProvider_GetImageReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
 			return func(ctx context.Context) irpcgen.Serializable {
 				var resp _irpc_ImgProvider_GetImageResp
-				resp.p0, resp.p1 = s.impl.GetImage()
+				resp.p0, resp.p1 = s.impl.GetImage(args.job)
+				return resp
+			}, nil
+		}, nil
+	case 2: // FullImageDimensions
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_ImgProvider_FullImageDimensionsReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_ImgProvider_FullImageDimensionsResp
+				resp.width, resp.height, resp.err = s.impl.FullImageDimensions(args.job)
+				return resp
+			}, nil
+		}, nil
+	case 3: // Progress
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_ImgProvider_ProgressReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_ImgProvider_ProgressResp
+				resp.p0, resp.p1 = s.impl.Progress(args.job)
+				return resp
+			}, nil
+		}, nil
+	case 4: // GetImageRows
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_ImgProvider_GetImageRowsReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_ImgProvider_GetImageRowsResp
+				resp.p0, resp.p1 = s.impl.GetImageRows(ctx, args.job, args.y, args.n)
+				return resp
+			}, nil
+		}, nil
+	case 5: // Jobs
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_ImgProvider_JobsResp
+				resp.p0, resp.p1 = s.impl.Jobs()
+				return resp
+			}, nil
+		}, nil
+	case 6: // CancelJob
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_ImgProvider_CancelJobReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_ImgProvider_CancelJobResp
+				resp.p0 = s.impl.CancelJob(args.job)
 				return resp
 			}, nil
 		}, nil
@@ -44,41 +116,709 @@ func (s *ImgProviderIrpcService) GetFuncCall(funcId irpcgen.FuncId) (irpcgen.Arg
 	}
 }
 
-// ImgProviderIrpcClient implements [ImgProvider] interface. It by forwards calls over network to [ImgProviderIrpcService] that provides the implementation.
-//
-// ImgProvider is implemented by the server and is called by the CLI client to get the full image once rendering is complete.
-type ImgProviderIrpcClient struct {
-	endpoint irpcgen.Endpoint
+// ImgProviderIrpcClient implements [ImgProvider] interface. It by forwards calls over network to [ImgProviderIrpcService] that provides the implementation.
+//
+// ImgProvider is implemented by the server and is called by the CLI client to get rendered images.
+// The server renders its own job (ServerJobID) and any number of jobs submitted by clients at once.
+type ImgProviderIrpcClient struct {
+	endpoint irpcgen.Endpoint
+}
+
+func NewImgProviderIrpcClient(endpoint irpcgen.Endpoint) (*ImgProviderIrpcClient, error) {
+	if err := endpoint.RegisterClient(_ImgProviderIrpcId); err != nil {
+		return nil, fmt.Errorf("register failed: %w", err)
+	}
+	return &ImgProviderIrpcClient{endpoint: endpoint}, nil
+}
+
+// SubmitJob implements [ImgProvider]
+//
+// SubmitJob starts rendering of w×h image of region and returns id of the new job.
+func (_c *ImgProviderIrpcClient) SubmitJob(region MandelRegion, w int, h int, params RenderParams) (JobID, error) {
+	var req = _irpc_ImgProvider_SubmitJobReq{
+		region: region,
+		w:      w,
+		h:      h,
+		params: params,
+	}
+	var resp _irpc_ImgProvider_SubmitJobResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 0, req, &resp); err != nil {
+		var zero _irpc_ImgProvider_SubmitJobResp
+		return zero.p0, err
+	}
+	return resp.p0, resp.p1
+}
+
+// GetImage implements [ImgProvider]
+//
+// GetImage returns the fully rendered image of job with 16 bits per channel.
+// Blocks until rendering is finished
+func (_c *ImgProviderIrpcClient) GetImage(job JobID) (*image.RGBA64, error) {
+	var req = _irpc_ImgProvider_GetImageReq{
+		job: job,
+	}
+	var resp _irpc_ImgProvider_GetImageResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 1, req, &resp); err != nil {
+		var zero _irpc_ImgProvider_GetImageResp
+		return zero.p0, err
+	}
+	return resp.p0, resp.p1
+}
+
+// FullImageDimensions implements [ImgProvider]
+//
+// FullImageDimensions returns the width and height of job's full image.
+func (_c *ImgProviderIrpcClient) FullImageDimensions(job JobID) (width int, height int, err error) {
+	var req = _irpc_ImgProvider_FullImageDimensionsReq{
+		job: job,
+	}
+	var resp _irpc_ImgProvider_FullImageDimensionsResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 2, req, &resp); err != nil {
+		var zero _irpc_ImgProvider_FullImageDimensionsResp
+		return zero.width, zero.height, err
+	}
+	return resp.width, resp.height, resp.err
+}
+
+// Progress implements [ImgProvider]
+//
+// Progress returns finished fraction of job's rendering, from 0 to 1.
+func (_c *ImgProviderIrpcClient) Progress(job JobID) (float64, error) {
+	var req = _irpc_ImgProvider_ProgressReq{
+		job: job,
+	}
+	var resp _irpc_ImgProvider_ProgressResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 3, req, &resp); err != nil {
+		var zero _irpc_ImgProvider_ProgressResp
+		return zero.p0, err
+	}
+	return resp.p0, resp.p1
+}
+
+// GetImageRows implements [ImgProvider]
+//
+// GetImageRows returns rows y..y+n-1 of job's image with 16 bits per channel, so that the image can be received in chunks.
+// Blocks until the rows are rendered or ctx is cancelled. Returned image has bounds of the rows.
+func (_c *ImgProviderIrpcClient) GetImageRows(ctx context.Context, job JobID, y int, n int) (*image.RGBA64, error) {
+	var req = _irpc_ImgProvider_GetImageRowsReq{
+		// ctx: ctx,
+		job: job,
+		y:   y,
+		n:   n,
+	}
+	var resp _irpc_ImgProvider_GetImageRowsResp
+	if err := _c.endpoint.CallRemoteFunc(ctx, _ImgProviderIrpcId, 4, req, &resp); err != nil {
+		var zero _irpc_ImgProvider_GetImageRowsResp
+		return zero.p0, err
+	}
+	return resp.p0, resp.p1
+}
+
+// Jobs implements [ImgProvider]
+//
+// Jobs returns status of all jobs known to the server.
+func (_c *ImgProviderIrpcClient) Jobs() ([]JobStatus, error) {
+	var resp _irpc_ImgProvider_JobsResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 5, irpcgen.EmptySerializable{}, &resp); err != nil {
+		var zero _irpc_ImgProvider_JobsResp
+		return zero.p0, err
+	}
+	return resp.p0, resp.p1
+}
+
+// CancelJob implements [ImgProvider]
+//
+// CancelJob stops rendering of submitted job. Its workers are cancelled and its image can't be received anymore.
+// The server's own job (ServerJobID) can't be cancelled.
+func (_c *ImgProviderIrpcClient) CancelJob(job JobID) error {
+	var req = _irpc_ImgProvider_CancelJobReq{
+		job: job,
+	}
+	var resp _irpc_ImgProvider_CancelJobResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 6, req, &resp); err != nil {
+		return err
+	}
+	return resp.p0
+}
+
+type _irpc_ImgProvider_SubmitJobReq struct {
+	region MandelRegion
+	w      int
+	h      int
+	params RenderParams
+}
+
+func (s _irpc_ImgProvider_SubmitJobReq) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, s MandelRegion) error {
+		if err := irpcgen.EncFloat64(enc, s.Xmin); err != nil {
+			return fmt.Errorf("serialize s.Xmin of type float64: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.Xmax); err != nil {
+			return fmt.Errorf("serialize s.Xmax of type float64: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.Ymin); err != nil {
+			return fmt.Errorf("serialize s.Ymin of type float64: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.Ymax); err != nil {
+			return fmt.Errorf("serialize s.Ymax of type float64: %w", err)
+		}
+		return nil
+	}(e, s.region); err != nil {
+		return fmt.Errorf("serialize \"region\" of type MandelRegion: %w", err)
+	}
+	if err := irpcgen.EncInt(e, s.w); err != nil {
+		return fmt.Errorf("serialize \"w\" of type int: %w", err)
+	}
+	if err := irpcgen.EncInt(e, s.h); err != nil {
+		return fmt.Errorf("serialize \"h\" of type int: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, s RenderParams) error {
+		if err := irpcgen.EncInt(enc, s.Mapping); err != nil {
+			return fmt.Errorf("serialize s.Mapping of type Mapping: %w", err)
+		}
+		if err := func(enc *irpcgen.Encoder, s OrbitTrap) error {
+			if err := irpcgen.EncInt(enc, s.Kind); err != nil {
+				return fmt.Errorf("serialize s.Kind of type TrapKind: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.X); err != nil {
+				return fmt.Errorf("serialize s.X of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Y); err != nil {
+				return fmt.Errorf("serialize s.Y of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Radius); err != nil {
+				return fmt.Errorf("serialize s.Radius of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Angle); err != nil {
+				return fmt.Errorf("serialize s.Angle of type float64: %w", err)
+			}
+			return nil
+		}(enc, s.Trap); err != nil {
+			return fmt.Errorf("serialize s.Trap of type OrbitTrap: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.TrapWeight); err != nil {
+			return fmt.Errorf("serialize s.TrapWeight of type float64: %w", err)
+		}
+		if err := func(enc *irpcgen.Encoder, s Palette) error {
+			if err := irpcgen.EncString(enc, s.Name); err != nil {
+				return fmt.Errorf("serialize s.Name of type string: %w", err)
+			}
+			if err := func(enc *irpcgen.Encoder, sl []GradientStop) error {
+				return irpcgen.EncSlice(enc, sl, "GradientStop", func(enc *irpcgen.Encoder, s GradientStop) error {
+					if err := irpcgen.EncFloat64(enc, s.Pos); err != nil {
+						return fmt.Errorf("serialize s.Pos of type float64: %w", err)
+					}
+					if err := irpcgen.EncUint8(enc, s.R); err != nil {
+						return fmt.Errorf("serialize s.R of type uint8: %w", err)
+					}
+					if err := irpcgen.EncUint8(enc, s.G); err != nil {
+						return fmt.Errorf("serialize s.G of type uint8: %w", err)
+					}
+					if err := irpcgen.EncUint8(enc, s.B); err != nil {
+						return fmt.Errorf("serialize s.B of type uint8: %w", err)
+					}
+					return nil
+				})
+			}(enc, s.Stops); err != nil {
+				return fmt.Errorf("serialize s.Stops of type []GradientStop: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Space); err != nil {
+				return fmt.Errorf("serialize s.Space of type ColorSpace: %w", err)
+			}
+			return nil
+		}(enc, s.Palette); err != nil {
+			return fmt.Errorf("serialize s.Palette of type Palette: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.PaletteCycle); err != nil {
+			return fmt.Errorf("serialize s.PaletteCycle of type float64: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.PaletteOffset); err != nil {
+			return fmt.Errorf("serialize s.PaletteOffset of type float64: %w", err)
+		}
+		return nil
+	}(e, s.params); err != nil {
+		return fmt.Errorf("serialize \"params\" of type RenderParams: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_SubmitJobReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, s *MandelRegion) error {
+		if err := irpcgen.DecFloat64(dec, &s.Xmin); err != nil {
+			return fmt.Errorf("deserialize s.Xmin of type float64: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.Xmax); err != nil {
+			return fmt.Errorf("deserialize s.Xmax of type float64: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.Ymin); err != nil {
+			return fmt.Errorf("deserialize s.Ymin of type float64: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.Ymax); err != nil {
+			return fmt.Errorf("deserialize s.Ymax of type float64: %w", err)
+		}
+		return nil
+	}(d, &s.region); err != nil {
+		return fmt.Errorf("deserialize region of type MandelRegion: %w", err)
+	}
+	if err := irpcgen.DecInt(d, &s.w); err != nil {
+		return fmt.Errorf("deserialize w of type int: %w", err)
+	}
+	if err := irpcgen.DecInt(d, &s.h); err != nil {
+		return fmt.Errorf("deserialize h of type int: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *RenderParams) error {
+		if err := irpcgen.DecInt(dec, &s.Mapping); err != nil {
+			return fmt.Errorf("deserialize s.Mapping of type Mapping: %w", err)
+		}
+		if err := func(dec *irpcgen.Decoder, s *OrbitTrap) error {
+			if err := irpcgen.DecInt(dec, &s.Kind); err != nil {
+				return fmt.Errorf("deserialize s.Kind of type TrapKind: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.X); err != nil {
+				return fmt.Errorf("deserialize s.X of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Y); err != nil {
+				return fmt.Errorf("deserialize s.Y of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Radius); err != nil {
+				return fmt.Errorf("deserialize s.Radius of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Angle); err != nil {
+				return fmt.Errorf("deserialize s.Angle of type float64: %w", err)
+			}
+			return nil
+		}(dec, &s.Trap); err != nil {
+			return fmt.Errorf("deserialize s.Trap of type OrbitTrap: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.TrapWeight); err != nil {
+			return fmt.Errorf("deserialize s.TrapWeight of type float64: %w", err)
+		}
+		if err := func(dec *irpcgen.Decoder, s *Palette) error {
+			if err := irpcgen.DecString(dec, &s.Name); err != nil {
+				return fmt.Errorf("deserialize s.Name of type string: %w", err)
+			}
+			if err := func(dec *irpcgen.Decoder, sl *[]GradientStop) error {
+				return irpcgen.DecSlice(dec, sl, "GradientStop", func(dec *irpcgen.Decoder, s *GradientStop) error {
+					if err := irpcgen.DecFloat64(dec, &s.Pos); err != nil {
+						return fmt.Errorf("deserialize s.Pos of type float64: %w", err)
+					}
+					if err := irpcgen.DecUint8(dec, &s.R); err != nil {
+						return fmt.Errorf("deserialize s.R of type uint8: %w", err)
+					}
+					if err := irpcgen.DecUint8(dec, &s.G); err != nil {
+						return fmt.Errorf("deserialize s.G of type uint8: %w", err)
+					}
+					if err := irpcgen.DecUint8(dec, &s.B); err != nil {
+						return fmt.Errorf("deserialize s.B of type uint8: %w", err)
+					}
+					return nil
+				})
+			}(dec, &s.Stops); err != nil {
+				return fmt.Errorf("deserialize s.Stops of type []GradientStop: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Space); err != nil {
+				return fmt.Errorf("deserialize s.Space of type ColorSpace: %w", err)
+			}
+			return nil
+		}(dec, &s.Palette); err != nil {
+			return fmt.Errorf("deserialize s.Palette of type Palette: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.PaletteCycle); err != nil {
+			return fmt.Errorf("deserialize s.PaletteCycle of type float64: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.PaletteOffset); err != nil {
+			return fmt.Errorf("deserialize s.PaletteOffset of type float64: %w", err)
+		}
+		return nil
+	}(d, &s.params); err != nil {
+		return fmt.Errorf("deserialize params of type RenderParams: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_SubmitJobResp struct {
+	p0 JobID
+	p1 error
+}
+
+func (s _irpc_ImgProvider_SubmitJobResp) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type JobID: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p1); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_SubmitJobResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type JobID: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_ImgProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p1); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
+}
+
+type _error_ImgProvider_impl struct {
+	_Error_0_ string
+}
+
+func (i _error_ImgProvider_impl) Error() string {
+	return i._Error_0_
+}
+
+type _irpc_ImgProvider_GetImageReq struct {
+	job JobID
+}
+
+func (s _irpc_ImgProvider_GetImageReq) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.job); err != nil {
+		return fmt.Errorf("serialize \"job\" of type JobID: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_GetImageReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.job); err != nil {
+		return fmt.Errorf("deserialize job of type JobID: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_GetImageResp struct {
+	p0 *image.RGBA64
+	p1 error
+}
+
+func (s _irpc_ImgProvider_GetImageResp) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, pt *image.RGBA64) error {
+		return irpcgen.EncPointer(enc, pt, "image.RGBA64", func(enc *irpcgen.Encoder, s image.RGBA64) error {
+			if err := irpcgen.EncByteSlice(enc, s.Pix); err != nil {
+				return fmt.Errorf("serialize s.Pix of type []uint8: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Stride); err != nil {
+				return fmt.Errorf("serialize s.Stride of type int: %w", err)
+			}
+			if err := func(enc *irpcgen.Encoder, s image.Rectangle) error {
+				if err := func(enc *irpcgen.Encoder, s image.Point) error {
+					if err := irpcgen.EncInt(enc, s.X); err != nil {
+						return fmt.Errorf("serialize s.X of type int: %w", err)
+					}
+					if err := irpcgen.EncInt(enc, s.Y); err != nil {
+						return fmt.Errorf("serialize s.Y of type int: %w", err)
+					}
+					return nil
+				}(enc, s.Min); err != nil {
+					return fmt.Errorf("serialize s.Min of type image.Point: %w", err)
+				}
+				if err := func(enc *irpcgen.Encoder, s image.Point) error {
+					if err := irpcgen.EncInt(enc, s.X); err != nil {
+						return fmt.Errorf("serialize s.X of type int: %w", err)
+					}
+					if err := irpcgen.EncInt(enc, s.Y); err != nil {
+						return fmt.Errorf("serialize s.Y of type int: %w", err)
+					}
+					return nil
+				}(enc, s.Max); err != nil {
+					return fmt.Errorf("serialize s.Max of type image.Point: %w", err)
+				}
+				return nil
+			}(enc, s.Rect); err != nil {
+				return fmt.Errorf("serialize s.Rect of type image.Rectangle: %w", err)
+			}
+			return nil
+		})
+	}(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type *image.RGBA64: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p1); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_GetImageResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, pt **image.RGBA64) error {
+		return irpcgen.DecPointer(dec, pt, "image.RGBA64", func(dec *irpcgen.Decoder, s *image.RGBA64) error {
+			if err := irpcgen.DecByteSlice(dec, &s.Pix); err != nil {
+				return fmt.Errorf("deserialize s.Pix of type []uint8: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Stride); err != nil {
+				return fmt.Errorf("deserialize s.Stride of type int: %w", err)
+			}
+			if err := func(dec *irpcgen.Decoder, s *image.Rectangle) error {
+				if err := func(dec *irpcgen.Decoder, s *image.Point) error {
+					if err := irpcgen.DecInt(dec, &s.X); err != nil {
+						return fmt.Errorf("deserialize s.X of type int: %w", err)
+					}
+					if err := irpcgen.DecInt(dec, &s.Y); err != nil {
+						return fmt.Errorf("deserialize s.Y of type int: %w", err)
+					}
+					return nil
+				}(dec, &s.Min); err != nil {
+					return fmt.Errorf("deserialize s.Min of type image.Point: %w", err)
+				}
+				if err := func(dec *irpcgen.Decoder, s *image.Point) error {
+					if err := irpcgen.DecInt(dec, &s.X); err != nil {
+						return fmt.Errorf("deserialize s.X of type int: %w", err)
+					}
+					if err := irpcgen.DecInt(dec, &s.Y); err != nil {
+						return fmt.Errorf("deserialize s.Y of type int: %w", err)
+					}
+					return nil
+				}(dec, &s.Max); err != nil {
+					return fmt.Errorf("deserialize s.Max of type image.Point: %w", err)
+				}
+				return nil
+			}(dec, &s.Rect); err != nil {
+				return fmt.Errorf("deserialize s.Rect of type image.Rectangle: %w", err)
+			}
+			return nil
+		})
+	}(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type *image.RGBA64: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_ImgProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p1); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_FullImageDimensionsReq struct {
+	job JobID
+}
+
+func (s _irpc_ImgProvider_FullImageDimensionsReq) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.job); err != nil {
+		return fmt.Errorf("serialize \"job\" of type JobID: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_FullImageDimensionsReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.job); err != nil {
+		return fmt.Errorf("deserialize job of type JobID: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_FullImageDimensionsResp struct {
+	width  int
+	height int
+	err    error
+}
+
+func (s _irpc_ImgProvider_FullImageDimensionsResp) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.width); err != nil {
+		return fmt.Errorf("serialize \"width\" of type int: %w", err)
+	}
+	if err := irpcgen.EncInt(e, s.height); err != nil {
+		return fmt.Errorf("serialize \"height\" of type int: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.err); err != nil {
+		return fmt.Errorf("serialize \"err\" of type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_FullImageDimensionsResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.width); err != nil {
+		return fmt.Errorf("deserialize width of type int: %w", err)
+	}
+	if err := irpcgen.DecInt(d, &s.height); err != nil {
+		return fmt.Errorf("deserialize height of type int: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_ImgProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.err); err != nil {
+		return fmt.Errorf("deserialize err of type error: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_ProgressReq struct {
+	job JobID
 }
 
-func NewImgProviderIrpcClient(endpoint irpcgen.Endpoint) (*ImgProviderIrpcClient, error) {
-	if err := endpoint.RegisterClient(_ImgProviderIrpcId); err != nil {
-		return nil, fmt.Errorf("register failed: %w", err)
+func (s _irpc_ImgProvider_ProgressReq) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.job); err != nil {
+		return fmt.Errorf("serialize \"job\" of type JobID: %w", err)
 	}
-	return &ImgProviderIrpcClient{endpoint: endpoint}, nil
+	return nil
+}
+func (s *_irpc_ImgProvider_ProgressReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.job); err != nil {
+		return fmt.Errorf("deserialize job of type JobID: %w", err)
+	}
+	return nil
 }
 
-// GetImage implements [ImgProvider]
-//
-// GetImage returns the fully rendered image.
-// Blocks until rendering is finished
-func (_c *ImgProviderIrpcClient) GetImage() (*image.RGBA, error) {
-	var resp _irpc_ImgProvider_GetImageResp
-	if err := _c.endpoint.CallRemoteFunc(context.Background(), _ImgProviderIrpcId, 0, irpcgen.EmptySerializable{}, &resp); err != nil {
-		var zero _irpc_ImgProvider_GetImageResp
-		return zero.p0, err
+type _irpc_ImgProvider_ProgressResp struct {
+	p0 float64
+	p1 error
+}
+
+func (s _irpc_ImgProvider_ProgressResp) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncFloat64(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type float64: %w", err)
 	}
-	return resp.p0, resp.p1
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p1); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_ProgressResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecFloat64(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type float64: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_ImgProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p1); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
 }
 
-type _irpc_ImgProvider_GetImageResp struct {
-	p0 *image.RGBA
+type _irpc_ImgProvider_GetImageRowsReq struct {
+	//ctx context.Context
+	job JobID
+	y   int
+	n   int
+}
+
+func (s _irpc_ImgProvider_GetImageRowsReq) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.job); err != nil {
+		return fmt.Errorf("serialize \"job\" of type JobID: %w", err)
+	}
+	if err := irpcgen.EncInt(e, s.y); err != nil {
+		return fmt.Errorf("serialize \"y\" of type int: %w", err)
+	}
+	if err := irpcgen.EncInt(e, s.n); err != nil {
+		return fmt.Errorf("serialize \"n\" of type int: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_GetImageRowsReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.job); err != nil {
+		return fmt.Errorf("deserialize job of type JobID: %w", err)
+	}
+	if err := irpcgen.DecInt(d, &s.y); err != nil {
+		return fmt.Errorf("deserialize y of type int: %w", err)
+	}
+	if err := irpcgen.DecInt(d, &s.n); err != nil {
+		return fmt.Errorf("deserialize n of type int: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_GetImageRowsResp struct {
+	p0 *image.RGBA64
 	p1 error
 }
 
-func (s _irpc_ImgProvider_GetImageResp) Serialize(e *irpcgen.Encoder) error {
-	if err := func(enc *irpcgen.Encoder, pt *image.RGBA) error {
-		return irpcgen.EncPointer(enc, pt, "image.RGBA", func(enc *irpcgen.Encoder, s image.RGBA) error {
+func (s _irpc_ImgProvider_GetImageRowsResp) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, pt *image.RGBA64) error {
+		return irpcgen.EncPointer(enc, pt, "image.RGBA64", func(enc *irpcgen.Encoder, s image.RGBA64) error {
 			if err := irpcgen.EncByteSlice(enc, s.Pix); err != nil {
 				return fmt.Errorf("serialize s.Pix of type []uint8: %w", err)
 			}
@@ -115,7 +855,7 @@ func (s _irpc_ImgProvider_GetImageResp) Serialize(e *irpcgen.Encoder) error {
 			return nil
 		})
 	}(e, s.p0); err != nil {
-		return fmt.Errorf("serialize type *image.RGBA: %w", err)
+		return fmt.Errorf("serialize type *image.RGBA64: %w", err)
 	}
 	if err := func(enc *irpcgen.Encoder, v error) error {
 		isNil := v == nil
@@ -135,9 +875,9 @@ func (s _irpc_ImgProvider_GetImageResp) Serialize(e *irpcgen.Encoder) error {
 	}
 	return nil
 }
-func (s *_irpc_ImgProvider_GetImageResp) Deserialize(d *irpcgen.Decoder) error {
-	if err := func(dec *irpcgen.Decoder, pt **image.RGBA) error {
-		return irpcgen.DecPointer(dec, pt, "image.RGBA", func(dec *irpcgen.Decoder, s *image.RGBA) error {
+func (s *_irpc_ImgProvider_GetImageRowsResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, pt **image.RGBA64) error {
+		return irpcgen.DecPointer(dec, pt, "image.RGBA64", func(dec *irpcgen.Decoder, s *image.RGBA64) error {
 			if err := irpcgen.DecByteSlice(dec, &s.Pix); err != nil {
 				return fmt.Errorf("deserialize s.Pix of type []uint8: %w", err)
 			}
@@ -174,7 +914,7 @@ func (s *_irpc_ImgProvider_GetImageResp) Deserialize(d *irpcgen.Decoder) error {
 			return nil
 		})
 	}(d, &s.p0); err != nil {
-		return fmt.Errorf("deserialize type *image.RGBA: %w", err)
+		return fmt.Errorf("deserialize type *image.RGBA64: %w", err)
 	}
 	if err := func(dec *irpcgen.Decoder, s *error) error {
 		var isNil bool
@@ -196,15 +936,169 @@ func (s *_irpc_ImgProvider_GetImageResp) Deserialize(d *irpcgen.Decoder) error {
 	return nil
 }
 
-type _error_ImgProvider_impl struct {
-	_Error_0_ string
+type _irpc_ImgProvider_JobsResp struct {
+	p0 []JobStatus
+	p1 error
 }
 
-func (i _error_ImgProvider_impl) Error() string {
-	return i._Error_0_
+func (s _irpc_ImgProvider_JobsResp) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, sl []JobStatus) error {
+		return irpcgen.EncSlice(enc, sl, "JobStatus", func(enc *irpcgen.Encoder, s JobStatus) error {
+			if err := irpcgen.EncInt(enc, s.ID); err != nil {
+				return fmt.Errorf("serialize s.ID of type JobID: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Width); err != nil {
+				return fmt.Errorf("serialize s.Width of type int: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Height); err != nil {
+				return fmt.Errorf("serialize s.Height of type int: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Progress); err != nil {
+				return fmt.Errorf("serialize s.Progress of type float64: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Renders); err != nil {
+				return fmt.Errorf("serialize s.Renders of type int: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Wasted); err != nil {
+				return fmt.Errorf("serialize s.Wasted of type int: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Cancelled); err != nil {
+				return fmt.Errorf("serialize s.Cancelled of type int: %w", err)
+			}
+			return nil
+		})
+	}(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type []JobStatus: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p1); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_JobsResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, sl *[]JobStatus) error {
+		return irpcgen.DecSlice(dec, sl, "JobStatus", func(dec *irpcgen.Decoder, s *JobStatus) error {
+			if err := irpcgen.DecInt(dec, &s.ID); err != nil {
+				return fmt.Errorf("deserialize s.ID of type JobID: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Width); err != nil {
+				return fmt.Errorf("deserialize s.Width of type int: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Height); err != nil {
+				return fmt.Errorf("deserialize s.Height of type int: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Progress); err != nil {
+				return fmt.Errorf("deserialize s.Progress of type float64: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Renders); err != nil {
+				return fmt.Errorf("deserialize s.Renders of type int: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Wasted); err != nil {
+				return fmt.Errorf("deserialize s.Wasted of type int: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Cancelled); err != nil {
+				return fmt.Errorf("deserialize s.Cancelled of type int: %w", err)
+			}
+			return nil
+		})
+	}(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type []JobStatus: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_ImgProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p1); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_CancelJobReq struct {
+	job JobID
+}
+
+func (s _irpc_ImgProvider_CancelJobReq) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.job); err != nil {
+		return fmt.Errorf("serialize \"job\" of type JobID: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_CancelJobReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.job); err != nil {
+		return fmt.Errorf("deserialize job of type JobID: %w", err)
+	}
+	return nil
+}
+
+type _irpc_ImgProvider_CancelJobResp struct {
+	p0 error
+}
+
+func (s _irpc_ImgProvider_CancelJobResp) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_ImgProvider_CancelJobResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_ImgProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
 }
 
-var _TileProviderIrpcId = irpcgen.ServiceId(0xc68e2faf4c016636)
+var _TileProviderIrpcId = irpcgen.ServiceId(0xcdfdb4f5cba4e14c)
 
 // TileProviderIrpcService provides [TileProvider] interface over irpc
 type TileProviderIrpcService struct {
@@ -262,7 +1156,15 @@ func (s *TileProviderIrpcService) GetFuncCall(funcId irpcgen.FuncId) (irpcgen.Ar
 				return resp
 			}, nil
 		}, nil
-	case 4: // WorkersCount
+	case 4: // Frames
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_TileProvider_FramesResp
+				resp.current, resp.total, resp.err = s.impl.Frames()
+				return resp
+			}, nil
+		}, nil
+	case 5: // WorkersCount
 		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
 			return func(ctx context.Context) irpcgen.Serializable {
 				var resp _irpc_TileProvider_WorkersCountResp
@@ -304,7 +1206,7 @@ func (_c *TileProviderIrpcClient) FinishedTiles() (map[image.Rectangle]struct{},
 
 // GetTileImg implements [TileProvider]
 //
-// GetTileImg returns image of given rectangle.
+// GetTileImg returns image of given rectangle, reduced to 8 bits per channel for display.
 func (_c *TileProviderIrpcClient) GetTileImg(rect image.Rectangle) (*image.RGBA, error) {
 	var req = _irpc_TileProvider_GetTileImgReq{
 		rect: rect,
@@ -338,7 +1240,20 @@ func (_c *TileProviderIrpcClient) TotalTilesCount() (int, error) {
 		var zero _irpc_TileProvider_TotalTilesCountResp
 		return zero.p0, err
 	}
-	return resp.p0, resp.p1
+	return resp.p0, resp.p1
+}
+
+// Frames implements [TileProvider]
+//
+// Frames returns index of the frame shown by FinishedTiles and GetTileImg and total count of frames.
+// Jobs rendering a single image have one frame.
+func (_c *TileProviderIrpcClient) Frames() (current int, total int, err error) {
+	var resp _irpc_TileProvider_FramesResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _TileProviderIrpcId, 4, irpcgen.EmptySerializable{}, &resp); err != nil {
+		var zero _irpc_TileProvider_FramesResp
+		return zero.current, zero.total, err
+	}
+	return resp.current, resp.total, resp.err
 }
 
 // WorkersCount implements [TileProvider]
@@ -346,7 +1261,7 @@ func (_c *TileProviderIrpcClient) TotalTilesCount() (int, error) {
 // WorkersCount returns the number of workers currently running.
 func (_c *TileProviderIrpcClient) WorkersCount() (int, error) {
 	var resp _irpc_TileProvider_WorkersCountResp
-	if err := _c.endpoint.CallRemoteFunc(context.Background(), _TileProviderIrpcId, 4, irpcgen.EmptySerializable{}, &resp); err != nil {
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _TileProviderIrpcId, 5, irpcgen.EmptySerializable{}, &resp); err != nil {
 		var zero _irpc_TileProvider_WorkersCountResp
 		return zero.p0, err
 	}
@@ -767,6 +1682,64 @@ func (s *_irpc_TileProvider_TotalTilesCountResp) Deserialize(d *irpcgen.Decoder)
 	return nil
 }
 
+type _irpc_TileProvider_FramesResp struct {
+	current int
+	total   int
+	err     error
+}
+
+func (s _irpc_TileProvider_FramesResp) Serialize(e *irpcgen.Encoder) error {
+	if err := irpcgen.EncInt(e, s.current); err != nil {
+		return fmt.Errorf("serialize \"current\" of type int: %w", err)
+	}
+	if err := irpcgen.EncInt(e, s.total); err != nil {
+		return fmt.Errorf("serialize \"total\" of type int: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.err); err != nil {
+		return fmt.Errorf("serialize \"err\" of type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_TileProvider_FramesResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := irpcgen.DecInt(d, &s.current); err != nil {
+		return fmt.Errorf("deserialize current of type int: %w", err)
+	}
+	if err := irpcgen.DecInt(d, &s.total); err != nil {
+		return fmt.Errorf("deserialize total of type int: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_TileProvider_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.err); err != nil {
+		return fmt.Errorf("deserialize err of type error: %w", err)
+	}
+	return nil
+}
+
 type _irpc_TileProvider_WorkersCountResp struct {
 	p0 int
 	p1 error
@@ -818,7 +1791,7 @@ func (s *_irpc_TileProvider_WorkersCountResp) Deserialize(d *irpcgen.Decoder) er
 	return nil
 }
 
-var _RendererIrpcId = irpcgen.ServiceId(0x90c55cec2fe449c2)
+var _RendererIrpcId = irpcgen.ServiceId(0x45d7b3229ff2047e)
 
 // RendererIrpcService provides [Renderer] interface over irpc
 type RendererIrpcService struct {
@@ -848,7 +1821,27 @@ func (s *RendererIrpcService) GetFuncCall(funcId irpcgen.FuncId) (irpcgen.ArgDes
 			}
 			return func(ctx context.Context) irpcgen.Serializable {
 				var resp _irpc_Renderer_RenderTileResp
-				resp.p0, resp.p1 = s.impl.RenderTile(args.reg, args.imgW, args.imgH, args.tile)
+				resp.p0, resp.p1 = s.impl.RenderTile(ctx, args.reg, args.params, args.imgW, args.imgH, args.tile)
+				return resp
+			}, nil
+		}, nil
+	case 1: // RenderDensity
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			var args _irpc_Renderer_RenderDensityReq
+			if err := args.Deserialize(d); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_Renderer_RenderDensityResp
+				resp.p0, resp.p1 = s.impl.RenderDensity(args.job, args.seed)
+				return resp
+			}, nil
+		}, nil
+	case 2: // Ping
+		return func(d *irpcgen.Decoder) (irpcgen.FuncExecutor, error) {
+			return func(ctx context.Context) irpcgen.Serializable {
+				var resp _irpc_Renderer_PingResp
+				resp.p0 = s.impl.Ping()
 				return resp
 			}, nil
 		}, nil
@@ -876,27 +1869,63 @@ func NewRendererIrpcClient(endpoint irpcgen.Endpoint) (*RendererIrpcClient, erro
 // RenderTile implements [Renderer]
 //
 // RenderTile renders a single tile of the Mandelbrot image.
+//   ctx: cancelled by the server once the tile isn't needed anymore, e.g. when another worker rendered it first
+//   params: coloring parameters of the job
 //   imgW, imgH: full image width and height
-func (_c *RendererIrpcClient) RenderTile(reg MandelRegion, imgW int, imgH int, tile image.Rectangle) (*image.RGBA, error) {
+// Returned tile has 16 bits per channel.
+func (_c *RendererIrpcClient) RenderTile(ctx context.Context, reg MandelRegion, params RenderParams, imgW int, imgH int, tile image.Rectangle) (*image.RGBA64, error) {
 	var req = _irpc_Renderer_RenderTileReq{
-		reg:  reg,
-		imgW: imgW,
-		imgH: imgH,
-		tile: tile,
+		// ctx: ctx,
+		reg:    reg,
+		params: params,
+		imgW:   imgW,
+		imgH:   imgH,
+		tile:   tile,
 	}
 	var resp _irpc_Renderer_RenderTileResp
-	if err := _c.endpoint.CallRemoteFunc(context.Background(), _RendererIrpcId, 0, req, &resp); err != nil {
+	if err := _c.endpoint.CallRemoteFunc(ctx, _RendererIrpcId, 0, req, &resp); err != nil {
 		var zero _irpc_Renderer_RenderTileResp
 		return zero.p0, err
 	}
 	return resp.p0, resp.p1
 }
 
+// RenderDensity implements [Renderer]
+//
+// RenderDensity samples job.Samples random points and accumulates their escaping orbits into a density grid.
+//
+//	seed: seed of the random generator. Calls with different seeds sample different points
+func (_c *RendererIrpcClient) RenderDensity(job DensityJob, seed uint64) (*DensityGrid, error) {
+	var req = _irpc_Renderer_RenderDensityReq{
+		job:  job,
+		seed: seed,
+	}
+	var resp _irpc_Renderer_RenderDensityResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _RendererIrpcId, 1, req, &resp); err != nil {
+		var zero _irpc_Renderer_RenderDensityResp
+		return zero.p0, err
+	}
+	return resp.p0, resp.p1
+}
+
+// Ping implements [Renderer]
+//
+// Ping is called by the server on connect. Clients that only observe (don't want to render) return an error, so they are not used as workers.
+func (_c *RendererIrpcClient) Ping() error {
+	var resp _irpc_Renderer_PingResp
+	if err := _c.endpoint.CallRemoteFunc(context.Background(), _RendererIrpcId, 2, irpcgen.EmptySerializable{}, &resp); err != nil {
+		return err
+	}
+	return resp.p0
+}
+
 type _irpc_Renderer_RenderTileReq struct {
-	reg  MandelRegion
-	imgW int
-	imgH int
-	tile image.Rectangle
+	//ctx context.Context
+	reg    MandelRegion
+	params RenderParams
+	imgW   int
+	imgH   int
+	tile   image.Rectangle
 }
 
 func (s _irpc_Renderer_RenderTileReq) Serialize(e *irpcgen.Encoder) error {
@@ -917,6 +1946,73 @@ func (s _irpc_Renderer_RenderTileReq) Serialize(e *irpcgen.Encoder) error {
 	}(e, s.reg); err != nil {
 		return fmt.Errorf("serialize \"reg\" of type MandelRegion: %w", err)
 	}
+	if err := func(enc *irpcgen.Encoder, s RenderParams) error {
+		if err := irpcgen.EncInt(enc, s.Mapping); err != nil {
+			return fmt.Errorf("serialize s.Mapping of type Mapping: %w", err)
+		}
+		if err := func(enc *irpcgen.Encoder, s OrbitTrap) error {
+			if err := irpcgen.EncInt(enc, s.Kind); err != nil {
+				return fmt.Errorf("serialize s.Kind of type TrapKind: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.X); err != nil {
+				return fmt.Errorf("serialize s.X of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Y); err != nil {
+				return fmt.Errorf("serialize s.Y of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Radius); err != nil {
+				return fmt.Errorf("serialize s.Radius of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Angle); err != nil {
+				return fmt.Errorf("serialize s.Angle of type float64: %w", err)
+			}
+			return nil
+		}(enc, s.Trap); err != nil {
+			return fmt.Errorf("serialize s.Trap of type OrbitTrap: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.TrapWeight); err != nil {
+			return fmt.Errorf("serialize s.TrapWeight of type float64: %w", err)
+		}
+		if err := func(enc *irpcgen.Encoder, s Palette) error {
+			if err := irpcgen.EncString(enc, s.Name); err != nil {
+				return fmt.Errorf("serialize s.Name of type string: %w", err)
+			}
+			if err := func(enc *irpcgen.Encoder, sl []GradientStop) error {
+				return irpcgen.EncSlice(enc, sl, "GradientStop", func(enc *irpcgen.Encoder, s GradientStop) error {
+					if err := irpcgen.EncFloat64(enc, s.Pos); err != nil {
+						return fmt.Errorf("serialize s.Pos of type float64: %w", err)
+					}
+					if err := irpcgen.EncUint8(enc, s.R); err != nil {
+						return fmt.Errorf("serialize s.R of type uint8: %w", err)
+					}
+					if err := irpcgen.EncUint8(enc, s.G); err != nil {
+						return fmt.Errorf("serialize s.G of type uint8: %w", err)
+					}
+					if err := irpcgen.EncUint8(enc, s.B); err != nil {
+						return fmt.Errorf("serialize s.B of type uint8: %w", err)
+					}
+					return nil
+				})
+			}(enc, s.Stops); err != nil {
+				return fmt.Errorf("serialize s.Stops of type []GradientStop: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Space); err != nil {
+				return fmt.Errorf("serialize s.Space of type ColorSpace: %w", err)
+			}
+			return nil
+		}(enc, s.Palette); err != nil {
+			return fmt.Errorf("serialize s.Palette of type Palette: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.PaletteCycle); err != nil {
+			return fmt.Errorf("serialize s.PaletteCycle of type float64: %w", err)
+		}
+		if err := irpcgen.EncFloat64(enc, s.PaletteOffset); err != nil {
+			return fmt.Errorf("serialize s.PaletteOffset of type float64: %w", err)
+		}
+		return nil
+	}(e, s.params); err != nil {
+		return fmt.Errorf("serialize \"params\" of type RenderParams: %w", err)
+	}
 	if err := irpcgen.EncInt(e, s.imgW); err != nil {
 		return fmt.Errorf("serialize \"imgW\" of type int: %w", err)
 	}
@@ -970,6 +2066,73 @@ func (s *_irpc_Renderer_RenderTileReq) Deserialize(d *irpcgen.Decoder) error {
 	}(d, &s.reg); err != nil {
 		return fmt.Errorf("deserialize reg of type MandelRegion: %w", err)
 	}
+	if err := func(dec *irpcgen.Decoder, s *RenderParams) error {
+		if err := irpcgen.DecInt(dec, &s.Mapping); err != nil {
+			return fmt.Errorf("deserialize s.Mapping of type Mapping: %w", err)
+		}
+		if err := func(dec *irpcgen.Decoder, s *OrbitTrap) error {
+			if err := irpcgen.DecInt(dec, &s.Kind); err != nil {
+				return fmt.Errorf("deserialize s.Kind of type TrapKind: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.X); err != nil {
+				return fmt.Errorf("deserialize s.X of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Y); err != nil {
+				return fmt.Errorf("deserialize s.Y of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Radius); err != nil {
+				return fmt.Errorf("deserialize s.Radius of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Angle); err != nil {
+				return fmt.Errorf("deserialize s.Angle of type float64: %w", err)
+			}
+			return nil
+		}(dec, &s.Trap); err != nil {
+			return fmt.Errorf("deserialize s.Trap of type OrbitTrap: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.TrapWeight); err != nil {
+			return fmt.Errorf("deserialize s.TrapWeight of type float64: %w", err)
+		}
+		if err := func(dec *irpcgen.Decoder, s *Palette) error {
+			if err := irpcgen.DecString(dec, &s.Name); err != nil {
+				return fmt.Errorf("deserialize s.Name of type string: %w", err)
+			}
+			if err := func(dec *irpcgen.Decoder, sl *[]GradientStop) error {
+				return irpcgen.DecSlice(dec, sl, "GradientStop", func(dec *irpcgen.Decoder, s *GradientStop) error {
+					if err := irpcgen.DecFloat64(dec, &s.Pos); err != nil {
+						return fmt.Errorf("deserialize s.Pos of type float64: %w", err)
+					}
+					if err := irpcgen.DecUint8(dec, &s.R); err != nil {
+						return fmt.Errorf("deserialize s.R of type uint8: %w", err)
+					}
+					if err := irpcgen.DecUint8(dec, &s.G); err != nil {
+						return fmt.Errorf("deserialize s.G of type uint8: %w", err)
+					}
+					if err := irpcgen.DecUint8(dec, &s.B); err != nil {
+						return fmt.Errorf("deserialize s.B of type uint8: %w", err)
+					}
+					return nil
+				})
+			}(dec, &s.Stops); err != nil {
+				return fmt.Errorf("deserialize s.Stops of type []GradientStop: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Space); err != nil {
+				return fmt.Errorf("deserialize s.Space of type ColorSpace: %w", err)
+			}
+			return nil
+		}(dec, &s.Palette); err != nil {
+			return fmt.Errorf("deserialize s.Palette of type Palette: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.PaletteCycle); err != nil {
+			return fmt.Errorf("deserialize s.PaletteCycle of type float64: %w", err)
+		}
+		if err := irpcgen.DecFloat64(dec, &s.PaletteOffset); err != nil {
+			return fmt.Errorf("deserialize s.PaletteOffset of type float64: %w", err)
+		}
+		return nil
+	}(d, &s.params); err != nil {
+		return fmt.Errorf("deserialize params of type RenderParams: %w", err)
+	}
 	if err := irpcgen.DecInt(d, &s.imgW); err != nil {
 		return fmt.Errorf("deserialize imgW of type int: %w", err)
 	}
@@ -1007,13 +2170,13 @@ func (s *_irpc_Renderer_RenderTileReq) Deserialize(d *irpcgen.Decoder) error {
 }
 
 type _irpc_Renderer_RenderTileResp struct {
-	p0 *image.RGBA
+	p0 *image.RGBA64
 	p1 error
 }
 
 func (s _irpc_Renderer_RenderTileResp) Serialize(e *irpcgen.Encoder) error {
-	if err := func(enc *irpcgen.Encoder, pt *image.RGBA) error {
-		return irpcgen.EncPointer(enc, pt, "image.RGBA", func(enc *irpcgen.Encoder, s image.RGBA) error {
+	if err := func(enc *irpcgen.Encoder, pt *image.RGBA64) error {
+		return irpcgen.EncPointer(enc, pt, "image.RGBA64", func(enc *irpcgen.Encoder, s image.RGBA64) error {
 			if err := irpcgen.EncByteSlice(enc, s.Pix); err != nil {
 				return fmt.Errorf("serialize s.Pix of type []uint8: %w", err)
 			}
@@ -1050,7 +2213,7 @@ func (s _irpc_Renderer_RenderTileResp) Serialize(e *irpcgen.Encoder) error {
 			return nil
 		})
 	}(e, s.p0); err != nil {
-		return fmt.Errorf("serialize type *image.RGBA: %w", err)
+		return fmt.Errorf("serialize type *image.RGBA64: %w", err)
 	}
 	if err := func(enc *irpcgen.Encoder, v error) error {
 		isNil := v == nil
@@ -1071,8 +2234,8 @@ func (s _irpc_Renderer_RenderTileResp) Serialize(e *irpcgen.Encoder) error {
 	return nil
 }
 func (s *_irpc_Renderer_RenderTileResp) Deserialize(d *irpcgen.Decoder) error {
-	if err := func(dec *irpcgen.Decoder, pt **image.RGBA) error {
-		return irpcgen.DecPointer(dec, pt, "image.RGBA", func(dec *irpcgen.Decoder, s *image.RGBA) error {
+	if err := func(dec *irpcgen.Decoder, pt **image.RGBA64) error {
+		return irpcgen.DecPointer(dec, pt, "image.RGBA64", func(dec *irpcgen.Decoder, s *image.RGBA64) error {
 			if err := irpcgen.DecByteSlice(dec, &s.Pix); err != nil {
 				return fmt.Errorf("deserialize s.Pix of type []uint8: %w", err)
 			}
@@ -1109,7 +2272,7 @@ func (s *_irpc_Renderer_RenderTileResp) Deserialize(d *irpcgen.Decoder) error {
 			return nil
 		})
 	}(d, &s.p0); err != nil {
-		return fmt.Errorf("deserialize type *image.RGBA: %w", err)
+		return fmt.Errorf("deserialize type *image.RGBA64: %w", err)
 	}
 	if err := func(dec *irpcgen.Decoder, s *error) error {
 		var isNil bool
@@ -1138,3 +2301,226 @@ type _error_Renderer_impl struct {
 func (i _error_Renderer_impl) Error() string {
 	return i._Error_0_
 }
+
+type _irpc_Renderer_RenderDensityReq struct {
+	job  DensityJob
+	seed uint64
+}
+
+func (s _irpc_Renderer_RenderDensityReq) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, s DensityJob) error {
+		if err := func(enc *irpcgen.Encoder, s MandelRegion) error {
+			if err := irpcgen.EncFloat64(enc, s.Xmin); err != nil {
+				return fmt.Errorf("serialize s.Xmin of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Xmax); err != nil {
+				return fmt.Errorf("serialize s.Xmax of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Ymin); err != nil {
+				return fmt.Errorf("serialize s.Ymin of type float64: %w", err)
+			}
+			if err := irpcgen.EncFloat64(enc, s.Ymax); err != nil {
+				return fmt.Errorf("serialize s.Ymax of type float64: %w", err)
+			}
+			return nil
+		}(enc, s.Region); err != nil {
+			return fmt.Errorf("serialize s.Region of type MandelRegion: %w", err)
+		}
+		if err := irpcgen.EncInt(enc, s.W); err != nil {
+			return fmt.Errorf("serialize s.W of type int: %w", err)
+		}
+		if err := irpcgen.EncInt(enc, s.H); err != nil {
+			return fmt.Errorf("serialize s.H of type int: %w", err)
+		}
+		if err := irpcgen.EncInt(enc, s.Samples); err != nil {
+			return fmt.Errorf("serialize s.Samples of type int: %w", err)
+		}
+		if err := irpcgen.EncInt(enc, s.MinIter); err != nil {
+			return fmt.Errorf("serialize s.MinIter of type int: %w", err)
+		}
+		if err := func(enc *irpcgen.Encoder, sl []int) error {
+			return irpcgen.EncSlice(enc, sl, "int", irpcgen.EncInt)
+		}(enc, s.MaxIters); err != nil {
+			return fmt.Errorf("serialize s.MaxIters of type []int: %w", err)
+		}
+		return nil
+	}(e, s.job); err != nil {
+		return fmt.Errorf("serialize \"job\" of type DensityJob: %w", err)
+	}
+	if err := irpcgen.EncUint64(e, s.seed); err != nil {
+		return fmt.Errorf("serialize \"seed\" of type uint64: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_Renderer_RenderDensityReq) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, s *DensityJob) error {
+		if err := func(dec *irpcgen.Decoder, s *MandelRegion) error {
+			if err := irpcgen.DecFloat64(dec, &s.Xmin); err != nil {
+				return fmt.Errorf("deserialize s.Xmin of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Xmax); err != nil {
+				return fmt.Errorf("deserialize s.Xmax of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Ymin); err != nil {
+				return fmt.Errorf("deserialize s.Ymin of type float64: %w", err)
+			}
+			if err := irpcgen.DecFloat64(dec, &s.Ymax); err != nil {
+				return fmt.Errorf("deserialize s.Ymax of type float64: %w", err)
+			}
+			return nil
+		}(dec, &s.Region); err != nil {
+			return fmt.Errorf("deserialize s.Region of type MandelRegion: %w", err)
+		}
+		if err := irpcgen.DecInt(dec, &s.W); err != nil {
+			return fmt.Errorf("deserialize s.W of type int: %w", err)
+		}
+		if err := irpcgen.DecInt(dec, &s.H); err != nil {
+			return fmt.Errorf("deserialize s.H of type int: %w", err)
+		}
+		if err := irpcgen.DecInt(dec, &s.Samples); err != nil {
+			return fmt.Errorf("deserialize s.Samples of type int: %w", err)
+		}
+		if err := irpcgen.DecInt(dec, &s.MinIter); err != nil {
+			return fmt.Errorf("deserialize s.MinIter of type int: %w", err)
+		}
+		if err := func(dec *irpcgen.Decoder, sl *[]int) error {
+			return irpcgen.DecSlice(dec, sl, "int", irpcgen.DecInt)
+		}(dec, &s.MaxIters); err != nil {
+			return fmt.Errorf("deserialize s.MaxIters of type []int: %w", err)
+		}
+		return nil
+	}(d, &s.job); err != nil {
+		return fmt.Errorf("deserialize job of type DensityJob: %w", err)
+	}
+	if err := irpcgen.DecUint64(d, &s.seed); err != nil {
+		return fmt.Errorf("deserialize seed of type uint64: %w", err)
+	}
+	return nil
+}
+
+type _irpc_Renderer_RenderDensityResp struct {
+	p0 *DensityGrid
+	p1 error
+}
+
+func (s _irpc_Renderer_RenderDensityResp) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, pt *DensityGrid) error {
+		return irpcgen.EncPointer(enc, pt, "DensityGrid", func(enc *irpcgen.Encoder, s DensityGrid) error {
+			if err := irpcgen.EncInt(enc, s.W); err != nil {
+				return fmt.Errorf("serialize s.W of type int: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.H); err != nil {
+				return fmt.Errorf("serialize s.H of type int: %w", err)
+			}
+			if err := irpcgen.EncInt(enc, s.Channels); err != nil {
+				return fmt.Errorf("serialize s.Channels of type int: %w", err)
+			}
+			if err := irpcgen.EncByteSlice(enc, s.Hits); err != nil {
+				return fmt.Errorf("serialize s.Hits of type []byte: %w", err)
+			}
+			return nil
+		})
+	}(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type *DensityGrid: %w", err)
+	}
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p1); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_Renderer_RenderDensityResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, pt **DensityGrid) error {
+		return irpcgen.DecPointer(dec, pt, "DensityGrid", func(dec *irpcgen.Decoder, s *DensityGrid) error {
+			if err := irpcgen.DecInt(dec, &s.W); err != nil {
+				return fmt.Errorf("deserialize s.W of type int: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.H); err != nil {
+				return fmt.Errorf("deserialize s.H of type int: %w", err)
+			}
+			if err := irpcgen.DecInt(dec, &s.Channels); err != nil {
+				return fmt.Errorf("deserialize s.Channels of type int: %w", err)
+			}
+			if err := irpcgen.DecByteSlice(dec, &s.Hits); err != nil {
+				return fmt.Errorf("deserialize s.Hits of type []byte: %w", err)
+			}
+			return nil
+		})
+	}(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type *DensityGrid: %w", err)
+	}
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_Renderer_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p1); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
+}
+
+type _irpc_Renderer_PingResp struct {
+	p0 error
+}
+
+func (s _irpc_Renderer_PingResp) Serialize(e *irpcgen.Encoder) error {
+	if err := func(enc *irpcgen.Encoder, v error) error {
+		isNil := v == nil
+		if err := irpcgen.EncIsNil(enc, isNil); err != nil {
+			return fmt.Errorf("serialize isNil == %t: %w", isNil, err)
+		}
+		if isNil {
+			return nil
+		}
+		_Error_0_ := v.Error()
+		if err := irpcgen.EncString(enc, _Error_0_); err != nil {
+			return fmt.Errorf("serialize \"v.Error()\" of type string: %w", err)
+		}
+		return nil
+	}(e, s.p0); err != nil {
+		return fmt.Errorf("serialize type error: %w", err)
+	}
+	return nil
+}
+func (s *_irpc_Renderer_PingResp) Deserialize(d *irpcgen.Decoder) error {
+	if err := func(dec *irpcgen.Decoder, s *error) error {
+		var isNil bool
+		if err := irpcgen.DecIsNil(dec, &isNil); err != nil {
+			return fmt.Errorf("deserialize isNil: %w", err)
+		}
+		if isNil {
+			return nil
+		}
+		var impl _error_Renderer_impl
+		if err := irpcgen.DecString(dec, &impl._Error_0_); err != nil {
+			return fmt.Errorf("deserialize \"_Error_0_\" string: %w", err)
+		}
+		*s = impl
+		return nil
+	}(d, &s.p0); err != nil {
+		return fmt.Errorf("deserialize type error: %w", err)
+	}
+	return nil
+}
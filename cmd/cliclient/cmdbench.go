@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"sync"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+// runBench renders an image locally, without the artificial slowdown of api.RenderTileSleepTime, and reports the speed.
+// The image is saved only if -o is given.
+func runBench(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	li := localImageFlags(fs, "", "output file, 16 bit png. The image is not saved if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := li.parse(); err != nil {
+		return err
+	}
+	reg, w, h, params := li.reg, li.w, li.h, li.params
+
+	api.RenderTileSleepTime = 0
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	// tiles are as large as the server's, so that the speed matches theirs
+	const tileSize = scheduler.DefaultTileSize
+	tiles := make(chan image.Rectangle)
+	go func() {
+		defer close(tiles)
+		for y := 0; y < h; y += tileSize {
+			for x := 0; x < w; x += tileSize {
+				select {
+				case tiles <- image.Rect(x, y, x+tileSize, y+tileSize).Intersect(img.Rect):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	log.Printf("Rendering %dx%d image with %d workers...", w, h, li.workers)
+	start := time.Now()
+	var tilesCount int
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < li.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			renderer := render.RendererImpl{}
+			for tile := range tiles {
+				tileImg, err := renderer.RenderTile(ctx, reg, params, w, h, tile)
+				if err != nil {
+					log.Printf("render of tile %s failed: %v", tile, err)
+					continue
+				}
+				m.Lock()
+				draw.Draw(img, tile, tileImg, tile.Min, draw.Src)
+				tilesCount++
+				m.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d tiles in %v: %.1f tiles/s, %.2f Mpx/s\n",
+		tilesCount, elapsed.Round(time.Millisecond), float64(tilesCount)/elapsed.Seconds(), float64(w*h)/1e6/elapsed.Seconds())
+
+	if li.output != "" {
+		if err := saveImage(li.output, img); err != nil {
+			return fmt.Errorf("saveImage: %w", err)
+		}
+		log.Printf("Image saved to %q", li.output)
+	}
+	return nil
+}
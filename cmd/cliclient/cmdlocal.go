@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+// runLocal renders an image without a server.
+// Tiles are handed out by the same scheduler the server uses, to renderers running in this process,
+// so the image is identical to the one rendered by distributed workers. Tile cache is not used.
+func runLocal(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("local", flag.ContinueOnError)
+	li := localImageFlags(fs, "mandel.png", "output file, 16 bit png")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := li.parse(); err != nil {
+		return err
+	}
+
+	// the artificial slowdown only demonstrates parallelization among distributed workers
+	api.RenderTileSleepTime = 0
+
+	job := scheduler.NewImgWorkScheduler(scheduler.NewMemTileStore(li.w, li.h), li.reg, li.params, scheduler.DefaultTileSize, scheduler.DefaultMaxTileCopies, nil)
+	pool := scheduler.NewWorkPool(nil)
+	pool.AddSource(job)
+
+	log.Printf("Rendering %dx%d image with %d local workers...", li.w, li.h, li.workers)
+	workCtx, stopWork := context.WithCancel(ctx)
+	defer stopWork()
+	var wg sync.WaitGroup
+	for i := 0; i < li.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.AddRenderer(workCtx, render.RendererImpl{}); err != nil && workCtx.Err() == nil {
+				log.Printf("worker %d: %v", i, err)
+			}
+		}()
+	}
+	// the job is never finished if all workers fail
+	workersGone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(workersGone)
+	}()
+
+	select {
+	case <-job.Done():
+	case <-workersGone:
+		return fmt.Errorf("all workers failed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	stopWork()
+
+	img, err := job.GetImage()
+	if err != nil {
+		return fmt.Errorf("job.GetImage: %w", err)
+	}
+	if err := saveImage(li.output, img); err != nil {
+		return fmt.Errorf("saveImage: %w", err)
+	}
+	log.Printf("Fully rendered image saved to %q", li.output)
+	return nil
+}
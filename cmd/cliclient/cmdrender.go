@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+)
+
+// runRender receives image of a job into a file, while rendering tiles for the server.
+// The server's job is received, unless a region is given by -preset or -region, which is then submitted as a new job.
+func runRender(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	server := serverFlags(fs)
+	output := fs.String("o", "mandel.png", "output file, 16 bit png")
+	size := fs.String("size", "1920x1080", "size of the submitted image as WxH")
+	preset := fs.String("preset", "", "predefined region to submit: "+presetNames())
+	region := fs.String("region", "", "region to submit as xmin,xmax,ymin,ymax. Server's job is received if neither -preset nor -region is given")
+	palette := fs.String("palette", "hsv", "palette of the submitted image: "+strings.Join(render.PaletteNames(), ", "))
+	workers := fs.Int("workers", 1, "number of tiles rendered in parallel for the server. 0 only receives the image")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := server.loadTLS(); err != nil {
+		return err
+	}
+
+	// validate the job before connecting, so that typos fail fast
+	var reg api.MandelRegion
+	var w, h int
+	var params api.RenderParams
+	var err error
+	submit := *preset != "" || *region != ""
+	if submit {
+		if reg, err = parseRegion(*preset, *region); err != nil {
+			return err
+		}
+		if w, h, err = parseSize(*size); err != nil {
+			return err
+		}
+		if params, err = parseParams(*palette); err != nil {
+			return err
+		}
+	}
+
+	// Step 1: Connect to Mandelbrot server
+	// Each worker is a connection of its own, as the server renders a single tile per connection at a time.
+	// The first connection is used to receive the image. Rendered tiles are counted for the progress bar
+	log.Printf("Connecting to Mandelbrot server on %s with %d workers...", server.addr, *workers)
+	var tilesRendered atomic.Int64
+	renderer := render.RendererImpl{OnTileRender: func(tile image.Rectangle) { tilesRendered.Add(1) }}
+	for i := 0; i < *workers; i++ {
+		ep, err := server.connect(renderer)
+		if err != nil {
+			return err
+		}
+		defer ep.Close()
+	}
+	ep, err := server.connect(observer{})
+	if err != nil {
+		return err
+	}
+	defer ep.Close()
+
+	// Step 2: Create a client for the ImgProvider interface
+	client, err := api.NewImgProviderIrpcClient(ep)
+	if err != nil {
+		return fmt.Errorf("failed to create ImgProvider client: %w", err)
+	}
+
+	// Step 3: Submit our own job, unless we just want the server's one
+	job := api.ServerJobID
+	if submit {
+		job, err = client.SubmitJob(reg, w, h, params)
+		if err != nil {
+			return fmt.Errorf("client.SubmitJob: %w", err)
+		}
+		log.Printf("Submitted job %d", job)
+	}
+
+	// Step 4: Receive the image in bands of rows as they are rendered, showing progress meanwhile
+	log.Printf("Receiving image of job %d into %q...", job, *output)
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		showProgress(progressCtx, client, job, &tilesRendered)
+		close(progressDone)
+	}()
+	err = receiveImage(ctx, client, job, *output)
+	stopProgress()
+	<-progressDone
+	if err != nil && submit && ctx.Err() != nil {
+		// nobody else waits for our job, so the workers are freed for other jobs
+		if err := client.CancelJob(job); err != nil {
+			log.Printf("client.CancelJob: %v", err)
+		} else {
+			log.Printf("Cancelled job %d", job)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("receiveImage: %w", err)
+	}
+
+	log.Printf("Fully rendered image saved to %q", *output)
+	return nil
+}
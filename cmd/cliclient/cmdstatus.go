@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// runStatus prints count of server's workers and the state of its jobs.
+// It connects as an observer, so it isn't counted as a worker.
+func runStatus(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	server := serverFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := server.loadTLS(); err != nil {
+		return err
+	}
+
+	ep, err := server.connect(observer{})
+	if err != nil {
+		return err
+	}
+	defer ep.Close()
+
+	tileClient, err := api.NewTileProviderIrpcClient(ep)
+	if err != nil {
+		return fmt.Errorf("failed to create TileProvider client: %w", err)
+	}
+	imgClient, err := api.NewImgProviderIrpcClient(ep)
+	if err != nil {
+		return fmt.Errorf("failed to create ImgProvider client: %w", err)
+	}
+
+	workers, err := tileClient.WorkersCount()
+	if err != nil {
+		return fmt.Errorf("tileClient.WorkersCount: %w", err)
+	}
+	jobs, err := imgClient.Jobs()
+	if err != nil {
+		return fmt.Errorf("imgClient.Jobs: %w", err)
+	}
+
+	fmt.Printf("server: %s\nworkers: %d\n\n", server.addr, workers)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "job\tsize\tprogress\trenders\twasted\tcancelled\t")
+	for _, job := range jobs {
+		fmt.Fprintf(tw, "%d\t%dx%d\t%.1f%%\t%d\t%d\t%d\t\n", job.ID, job.Width, job.Height, job.Progress*100, job.Renders, job.Wasted, job.Cancelled)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"image"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marben/irpc_dist_mandel/render"
+)
+
+// workReconnectDelay is the wait before reconnecting a worker to the server
+const workReconnectDelay = 5 * time.Second
+
+// runWork renders tiles for the server until ctx is done.
+// Workers reconnect when the server goes away, so the command never exits on its own.
+func runWork(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("work", flag.ContinueOnError)
+	server := serverFlags(fs)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of tiles rendered in parallel")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := server.loadTLS(); err != nil {
+		return err
+	}
+
+	log.Printf("Working for %s with %d workers, ctrl+c to stop...", server.addr, *workers)
+	var tilesRendered atomic.Int64
+	renderer := render.RendererImpl{OnTileRender: func(tile image.Rectangle) { tilesRendered.Add(1) }}
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				ep, err := server.connect(renderer)
+				if err != nil {
+					log.Printf("worker %d: %v", i, err)
+				} else {
+					select {
+					case <-ep.Context().Done():
+						log.Printf("worker %d: disconnected: %v", i, context.Cause(ep.Context()))
+					case <-ctx.Done():
+						ep.Close()
+						return
+					}
+				}
+
+				select {
+				case <-time.After(workReconnectDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			log.Printf("%d tiles rendered", tilesRendered.Load())
+		case <-ctx.Done():
+			wg.Wait()
+			log.Printf("Stopped, %d tiles rendered", tilesRendered.Load())
+			return nil
+		}
+	}
+}
@@ -1,73 +1,193 @@
 // cliclient.go is a CLI client for the distributed Mandelbrot renderer.
-// It connects to the Mandelbrot server, requests the fully rendered image, and saves it as a PNG file.
+// It has several commands:
+//
+//	render  contributes CPU to the server while receiving an image (server's job or a submitted one) into a file
+//	work    only contributes CPU, until interrupted
+//	status  prints jobs of the server and count of its workers
+//	local   renders an image on this machine, without a server
+//	bench   measures rendering speed of this machine, without a server
+//
+// Run with -h after the command name to see its flags.
 
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
-	"image/png"
 	"log"
-	"net"
 	"os"
+	"os/signal"
+	"runtime"
+	"strings"
 
-	"github.com/marben/irpc"
 	api "github.com/marben/irpc_dist_mandel"
 	"github.com/marben/irpc_dist_mandel/render"
 )
 
+// command runs a subcommand with its arguments (flags)
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"render": runRender,
+	"work":   runWork,
+	"status": runStatus,
+	"local":  runLocal,
+	"bench":  runBench,
+}
+
+const usage = `usage: cliclient [command] [flags]
+
+commands:
+  render  receive an image from the server into a file, rendering tiles meanwhile (default)
+  work    render tiles for the server until interrupted
+  status  print server's jobs and count of its workers
+  local   render an image locally, without a server
+  bench   measure local rendering speed
+
+run 'cliclient <command> -h' for command's flags
+`
+
 // main is the entry point for the CLI client.
 // It runs the client logic and logs any fatal errors.
 // Note: All rendering is performed by clients (web and CLI); the server only coordinates and distributes work.
 func main() {
-	log.Printf("Starting CLI client...")
-	if err := run(); err != nil {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	// render is the default command, so that plain 'cliclient' or 'cliclient -o x.png' works
+	name, args := "render", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd, found := commands[name]
+	if !found {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Interrupt (ctrl+c) cancels the command
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd(ctx, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
 		log.Fatalf("FATAL: %v", err)
 	}
 }
 
-// run connects to the Mandelbrot server, requests the rendered image, and saves it as a PNG file.
-// Returns an error if any step fails.
-func run() error {
-	// Step 1: Connect to Mandelbrot server
-	log.Printf("Connecting to Mandelbrot server on :8081...")
-	tcpConn, err := net.Dial("tcp", ":8081")
-	if err != nil {
-		return fmt.Errorf("failed to connect to server: %w", err)
-	}
+var errObserver = errors.New("observer doesn't render")
+
+// observer is api.Renderer of connections that only observe or receive images.
+// It fails the server's Ping, so the server doesn't use it as a worker.
+// (the service still has to be provided, calling a service the client doesn't have closes the connection)
+type observer struct{}
 
-	// Step 2: Create the renderer service, which the server can call to render tiles using our CPU
-	renderer := render.RendererImpl{OnTileRender: func(tile image.Rectangle) { log.Printf("Rendering tile: %s", tile) }}
-	rendererService := api.NewRendererIrpcService(renderer)
-	ep := irpc.NewEndpoint(tcpConn, irpc.WithEndpointServices(rendererService))
+func (observer) Ping() error { return errObserver }
+
+func (observer) RenderTile(ctx context.Context, reg api.MandelRegion, params api.RenderParams, imgW, imgH int, tile image.Rectangle) (*image.RGBA64, error) {
+	return nil, errObserver
+}
+
+func (observer) RenderDensity(job api.DensityJob, seed uint64) (*api.DensityGrid, error) {
+	return nil, errObserver
+}
 
-	// Step 3: Create a client for the ImgProvider interface
-	log.Printf("Creating ImgProvider client...")
-	client, err := api.NewImgProviderIrpcClient(ep)
-	if err != nil {
-		return fmt.Errorf("failed to create ImgProvider client: %w", err)
+// parseSize parses image size given as WxH
+func parseSize(size string) (w, h int, err error) {
+	if _, err := fmt.Sscanf(size, "%dx%d", &w, &h); err != nil {
+		return 0, 0, fmt.Errorf("invalid size %q: %w", size, err)
 	}
+	if w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q", size)
+	}
+	return w, h, nil
+}
 
-	// Step 4: Request the fully rendered image from the server
-	log.Printf("Requesting fully rendered image from server...")
-	img, err := client.GetImage()
-	if err != nil {
-		return fmt.Errorf("client.GetImage: %w", err)
+// parseRegion returns region given either by preset name (see api.Regions) or as xmin,xmax,ymin,ymax
+func parseRegion(preset, region string) (api.MandelRegion, error) {
+	if preset != "" {
+		reg, found := api.Regions[preset]
+		if !found {
+			return api.MandelRegion{}, fmt.Errorf("unknown preset %q, available presets: %s", preset, presetNames())
+		}
+		return reg, nil
 	}
 
-	// Step 5: Save the rendered image to a PNG file
-	filename := "mandel.png"
-	log.Printf("Saving rendered image to %q...", filename)
-	f, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	var reg api.MandelRegion
+	if _, err := fmt.Sscanf(region, "%g,%g,%g,%g", &reg.Xmin, &reg.Xmax, &reg.Ymin, &reg.Ymax); err != nil {
+		return api.MandelRegion{}, fmt.Errorf("invalid region %q: %w", region, err)
+	}
+	// the same check as the server's, so that submitted regions fail before connecting
+	if err := reg.Validate(); err != nil {
+		return api.MandelRegion{}, err
 	}
-	defer f.Close()
+	return reg, nil
+}
 
-	if err := png.Encode(f, img); err != nil {
-		return fmt.Errorf("failed to encode PNG: %w", err)
+// parseParams returns default render params with palette of given name
+func parseParams(palette string) (api.RenderParams, error) {
+	params := api.DefaultRenderParams
+	var found bool
+	if params.Palette, found = render.LookupPalette(palette); !found {
+		return api.RenderParams{}, fmt.Errorf("unknown palette %q", palette)
 	}
+	return params, nil
+}
 
-	log.Printf("Fully rendered image saved to %q", filename)
+// presetNames returns names of api.Regions, comma separated
+func presetNames() string {
+	return strings.Join(api.RegionNames(), ", ")
+}
+
+// localImage is the image rendered on this machine, given by flags common to local and bench commands
+type localImage struct {
+	output  string
+	size    string
+	preset  string
+	region  string
+	palette string
+	workers int
+
+	// set by parse
+	reg    api.MandelRegion
+	w, h   int
+	params api.RenderParams
+}
+
+// localImageFlags adds flags of the image to fs, -o defaults to output. Call parse once the flags are parsed.
+func localImageFlags(fs *flag.FlagSet, output, outputUsage string) *localImage {
+	li := &localImage{}
+	fs.StringVar(&li.output, "o", output, outputUsage)
+	fs.StringVar(&li.size, "size", "1920x1080", "size of the image as WxH")
+	fs.StringVar(&li.preset, "preset", "seahorse-valley", "predefined region: "+presetNames())
+	fs.StringVar(&li.region, "region", "", "region as xmin,xmax,ymin,ymax. Overrides -preset")
+	fs.StringVar(&li.palette, "palette", "hsv", "palette: "+strings.Join(render.PaletteNames(), ", "))
+	fs.IntVar(&li.workers, "workers", runtime.NumCPU(), "number of tiles rendered in parallel")
+	return li
+}
+
+// parse validates the flags, so that typos fail before rendering
+func (li *localImage) parse() error {
+	preset := li.preset
+	if li.region != "" {
+		preset = ""
+	}
+	var err error
+	if li.reg, err = parseRegion(preset, li.region); err != nil {
+		return err
+	}
+	if li.w, li.h, err = parseSize(li.size); err != nil {
+		return err
+	}
+	if li.params, err = parseParams(li.palette); err != nil {
+		return err
+	}
+	if li.workers < 1 {
+		return fmt.Errorf("invalid number of workers %d", li.workers)
+	}
 	return nil
 }
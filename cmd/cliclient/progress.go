@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+const progressBarWidth = 40
+
+// showProgress polls client for progress of job's rendering and prints it as a progress bar on a single line,
+// along with the count of tiles rendered by this client. It returns once ctx is done.
+func showProgress(ctx context.Context, client api.ImgProvider, job api.JobID, tilesRendered *atomic.Int64) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if progress, err := client.Progress(job); err == nil {
+			done := int(progress * progressBarWidth)
+			fmt.Fprintf(os.Stderr, "\r[%s%s] %5.1f%%  %d tiles rendered here",
+				strings.Repeat("#", done), strings.Repeat("-", progressBarWidth-done), progress*100, tilesRendered.Load())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr)
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/pngstream"
+)
+
+// receiveBand is the number of rows requested from the server at once
+const receiveBand = 64
+
+// receiveImage receives job's image from client band of rows by band and saves it to filename as 16 bit png.
+// png is written as the bands arrive, so the whole image is never in memory.
+func receiveImage(ctx context.Context, client api.ImgProvider, job api.JobID, filename string) error {
+	w, h, err := client.FullImageDimensions(job)
+	if err != nil {
+		return fmt.Errorf("client.FullImageDimensions: %w", err)
+	}
+
+	return writeOutput(filename, func(out io.Writer) error {
+		pw, err := pngstream.NewWriter(out, w, h)
+		if err != nil {
+			return fmt.Errorf("pngstream.NewWriter: %w", err)
+		}
+		for y := 0; y < h; y += receiveBand {
+			rows, err := client.GetImageRows(ctx, job, y, receiveBand)
+			if err != nil {
+				return fmt.Errorf("client.GetImageRows: %w", err)
+			}
+			if err := pw.WriteRows(rows); err != nil {
+				return fmt.Errorf("failed to write rows to %q: %w", filename, err)
+			}
+		}
+		if err := pw.Close(); err != nil {
+			return fmt.Errorf("failed to encode %q: %w", filename, err)
+		}
+		return nil
+	})
+}
+
+// writeOutput writes filename by write through a temporary file in the same directory,
+// which is renamed to filename only once write succeeds. On error the temporary file is removed,
+// so that an interrupted or failed render never leaves a truncated image behind.
+func writeOutput(filename string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	if err := write(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", filename, err)
+	}
+	// CreateTemp creates the file readable by owner only, output should have the permissions of os.Create
+	if err := f.Chmod(0o644); err != nil {
+		return fmt.Errorf("failed to set permissions of %q: %w", filename, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", filename, err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("failed to rename output file: %w", err)
+	}
+	return nil
+}
+
+// saveImage saves img to filename as 16 bits per channel png
+func saveImage(filename string, img *image.RGBA64) error {
+	return writeOutput(filename, func(w io.Writer) error {
+		if err := png.Encode(w, img); err != nil {
+			return fmt.Errorf("failed to encode %q: %w", filename, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/marben/irpc"
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// server is the Mandelbrot server commands connect to, given by flags common to these commands
+type server struct {
+	addr     string
+	token    string
+	useTLS   bool
+	caFile   string
+	certFile string
+	keyFile  string
+
+	tlsConf *tls.Config // set by loadTLS, nil for plain tcp
+}
+
+// serverFlags adds flags of the server connection to fs. Call loadTLS once the flags are parsed.
+func serverFlags(fs *flag.FlagSet) *server {
+	s := &server{}
+	fs.StringVar(&s.addr, "server", ":8081", "address of the server")
+	fs.StringVar(&s.token, "token", os.Getenv("MANDEL_TOKEN"), "access token, if the server requires one. Defaults to MANDEL_TOKEN environment variable")
+	fs.BoolVar(&s.useTLS, "tls", false, "connect using TLS. Implied by -ca and -cert")
+	fs.StringVar(&s.caFile, "ca", "", "PEM file of CA certificates verifying the server, e.g. its self-signed certificate. System CAs are used if empty")
+	fs.StringVar(&s.certFile, "cert", "", "PEM client certificate file, for servers requiring mutual TLS")
+	fs.StringVar(&s.keyFile, "key", "", "PEM private key file of -cert")
+	return s
+}
+
+// loadTLS prepares TLS config given by the flags, so that bad files fail before connecting
+func (s *server) loadTLS() error {
+	if !s.useTLS && s.caFile == "" && s.certFile == "" {
+		return nil
+	}
+	if (s.certFile == "") != (s.keyFile == "") {
+		return errors.New("-cert and -key must be set together")
+	}
+
+	// certificate has to match the host. Servers on local addresses like ":8081" are verified as localhost
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return fmt.Errorf("invalid server address %q: %w", s.addr, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	conf := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	if s.caFile != "" {
+		data, err := os.ReadFile(s.caFile)
+		if err != nil {
+			return err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in %q", s.caFile)
+		}
+	}
+	if s.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+		if err != nil {
+			return fmt.Errorf("tls.LoadX509KeyPair: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	s.tlsConf = conf
+	return nil
+}
+
+// connect connects to the Mandelbrot server.
+// The server can call renderer to render tiles using our CPU. Use observer{} for connections that shouldn't render.
+func (s *server) connect(renderer api.Renderer) (*irpc.Endpoint, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.tlsConf != nil {
+		// handshake right away, so that certificate problems are reported as connection errors
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server %q: %w", s.addr, err)
+	}
+
+	// the server accepts the connection only once our token is authenticated
+	conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	if err := api.ClientHandshake(conn, s.token); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("server %q: %w", s.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return irpc.NewEndpoint(conn, irpc.WithEndpointServices(api.NewRendererIrpcService(renderer))), nil
+}
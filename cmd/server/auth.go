@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// role is a permission granted by an access token
+type role string
+
+const (
+	roleWorker    role = "worker"    // may render tiles (serve api.Renderer)
+	roleViewer    role = "viewer"    // may watch rendering and download images (api.TileProvider, api.ImgProvider, map tiles)
+	roleSubmitter role = "submitter" // may submit and cancel jobs (api.ImgProvider.SubmitJob, CancelJob)
+)
+
+var allRoles = []role{roleWorker, roleViewer, roleSubmitter}
+
+// identity of a client, given by its token
+type identity struct {
+	name    string
+	roles   []role
+	expires time.Time // zero never expires
+	key     [sha256.Size]byte
+}
+
+// anonymous is identity of all clients, when authentication is disabled
+var anonymous = &identity{name: "anonymous", roles: allRoles}
+
+// has returns true if id was granted role r
+func (id *identity) has(r role) bool {
+	return slices.Contains(id.roles, r)
+}
+
+// require returns error if id wasn't granted role r
+func (id *identity) require(r role) error {
+	if !id.has(r) {
+		return fmt.Errorf("forbidden: %q doesn't have role %s", id.name, r)
+	}
+	return nil
+}
+
+// tokenFileEntry is an access token in the tokens file
+type tokenFileEntry struct {
+	Name    string    `json:"name"`
+	Token   string    `json:"token"`
+	Roles   []role    `json:"roles"`
+	Expires time.Time `json:"expires"` // optional
+}
+
+// tokenStore holds access tokens of the tokens file. It is reloaded to add or revoke tokens.
+// nil *tokenStore disables authentication, every client is then anonymous with all roles.
+type tokenStore struct {
+	filename string
+
+	ids map[[sha256.Size]byte]*identity // by sha256 of the token
+	m   sync.RWMutex
+}
+
+// loadTokenStore loads tokens of json file filename. Empty filename disables authentication.
+func loadTokenStore(filename string) (*tokenStore, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	ts := &tokenStore{filename: filename}
+	if err := ts.reload(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// reload replaces tokens by current content of the tokens file.
+// Clients with removed or changed tokens are not disconnected by reload, see rpcServer.dropRevoked.
+func (ts *tokenStore) reload() error {
+	data, err := os.ReadFile(ts.filename)
+	if err != nil {
+		return err
+	}
+	var entries []tokenFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("json.Unmarshal %q: %w", ts.filename, err)
+	}
+
+	ids := make(map[[sha256.Size]byte]*identity, len(entries))
+	var errs []error
+	for i, e := range entries {
+		key := sha256.Sum256([]byte(e.Token))
+		switch {
+		case e.Name == "":
+			errs = append(errs, fmt.Errorf("token %d: name is empty", i))
+		case len(e.Token) < 16:
+			errs = append(errs, fmt.Errorf("token %q: shorter than 16 characters", e.Name))
+		case strings.ContainsAny(e.Token, "\r\n"):
+			errs = append(errs, fmt.Errorf("token %q: contains line break", e.Name))
+		case ids[key] != nil:
+			errs = append(errs, fmt.Errorf("token %q: same as token %q", e.Name, ids[key].name))
+		}
+		for _, r := range e.Roles {
+			if !slices.Contains(allRoles, r) {
+				errs = append(errs, fmt.Errorf("token %q: unknown role %q", e.Name, r))
+			}
+		}
+		ids[key] = &identity{name: e.Name, roles: e.Roles, expires: e.Expires, key: key}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%q: %w", ts.filename, err)
+	}
+
+	ts.m.Lock()
+	ts.ids = ids
+	ts.m.Unlock()
+	return nil
+}
+
+// authenticate returns identity of token
+func (ts *tokenStore) authenticate(token string) (*identity, error) {
+	if ts == nil {
+		return anonymous, nil
+	}
+	if token == "" {
+		return nil, errors.New("access token required")
+	}
+	ts.m.RLock()
+	id := ts.ids[sha256.Sum256([]byte(token))]
+	ts.m.RUnlock()
+	if id == nil {
+		return nil, errors.New("invalid access token")
+	}
+	if !id.expires.IsZero() && time.Now().After(id.expires) {
+		return nil, fmt.Errorf("access token %q expired", id.name)
+	}
+	return id, nil
+}
+
+// valid returns false if token of id was revoked, its roles changed or it expired
+func (ts *tokenStore) valid(id *identity) bool {
+	if ts == nil {
+		return true
+	}
+	ts.m.RLock()
+	cur := ts.ids[id.key]
+	ts.m.RUnlock()
+	return cur != nil && slices.Equal(cur.roles, id.roles) &&
+		(cur.expires.IsZero() || time.Now().Before(cur.expires))
+}
+
+// tokensReloadLoop reloads ts on SIGHUP and disconnects clients of srv with revoked or expired tokens, until ctx is done
+func tokensReloadLoop(ctx context.Context, ts *tokenStore, srv *rpcServer) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			if err := ts.reload(); err != nil {
+				// previous tokens stay in place
+				log.Printf("tokens: reload: %v", err)
+				continue
+			}
+			log.Printf("tokens: reloaded %q", ts.filename)
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		srv.dropRevoked()
+	}
+}
+
+// requestToken returns access token of http request, given by "token" query parameter or as bearer token
+func requestToken(r *http.Request) string {
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// requireRole lets only requests with token granted role r through to h
+func requireRole(ts *tokenStore, r role, h http.Handler) http.Handler {
+	if ts == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := ts.authenticate(requestToken(req))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := id.require(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+var _ api.ImgProvider = authImgProvider{}
+
+// authImgProvider checks roles of client id before each call of api.ImgProvider
+type authImgProvider struct {
+	api.ImgProvider
+	id *identity
+}
+
+func (p authImgProvider) SubmitJob(region api.MandelRegion, w, h int, params api.RenderParams) (api.JobID, error) {
+	if err := p.id.require(roleSubmitter); err != nil {
+		return 0, err
+	}
+	return p.ImgProvider.SubmitJob(region, w, h, params)
+}
+
+func (p authImgProvider) GetImage(job api.JobID) (*image.RGBA64, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return nil, err
+	}
+	return p.ImgProvider.GetImage(job)
+}
+
+func (p authImgProvider) FullImageDimensions(job api.JobID) (width, height int, err error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return 0, 0, err
+	}
+	return p.ImgProvider.FullImageDimensions(job)
+}
+
+func (p authImgProvider) Progress(job api.JobID) (float64, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return 0, err
+	}
+	return p.ImgProvider.Progress(job)
+}
+
+func (p authImgProvider) GetImageRows(ctx context.Context, job api.JobID, y, n int) (*image.RGBA64, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return nil, err
+	}
+	return p.ImgProvider.GetImageRows(ctx, job, y, n)
+}
+
+func (p authImgProvider) Jobs() ([]api.JobStatus, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return nil, err
+	}
+	return p.ImgProvider.Jobs()
+}
+
+func (p authImgProvider) CancelJob(job api.JobID) error {
+	if err := p.id.require(roleSubmitter); err != nil {
+		return err
+	}
+	return p.ImgProvider.CancelJob(job)
+}
+
+var _ api.TileProvider = authTileProvider{}
+
+// authTileProvider checks that client id is a viewer before each call of api.TileProvider
+type authTileProvider struct {
+	api.TileProvider
+	id *identity
+}
+
+func (p authTileProvider) FinishedTiles() (map[image.Rectangle]struct{}, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return nil, err
+	}
+	return p.TileProvider.FinishedTiles()
+}
+
+func (p authTileProvider) GetTileImg(rect image.Rectangle) (*image.RGBA, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return nil, err
+	}
+	return p.TileProvider.GetTileImg(rect)
+}
+
+func (p authTileProvider) FullImageDimensions() (width, height int, err error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return 0, 0, err
+	}
+	return p.TileProvider.FullImageDimensions()
+}
+
+func (p authTileProvider) TotalTilesCount() (int, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return 0, err
+	}
+	return p.TileProvider.TotalTilesCount()
+}
+
+func (p authTileProvider) Frames() (current, total int, err error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return 0, 0, err
+	}
+	return p.TileProvider.Frames()
+}
+
+func (p authTileProvider) WorkersCount() (int, error) {
+	if err := p.id.require(roleViewer); err != nil {
+		return 0, err
+	}
+	return p.TileProvider.WorkersCount()
+}
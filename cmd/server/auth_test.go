@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTokensFile writes entries as tokens file into a temporary directory
+func writeTokensFile(t *testing.T, entries []tokenFileEntry) string {
+	t.Helper()
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "tokens.json")
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	return filename
+}
+
+func TestTokenStoreAuthenticate(t *testing.T) {
+	ts, err := loadTokenStore(writeTokensFile(t, []tokenFileEntry{
+		{Name: "worker", Token: "worker-token-0123456789", Roles: []role{roleWorker}},
+		{Name: "admin", Token: "admin-token-0123456789", Roles: []role{roleViewer, roleSubmitter}},
+		{Name: "expired", Token: "expired-token-0123456789", Roles: allRoles, Expires: time.Now().Add(-time.Hour)},
+		{Name: "later", Token: "later-token-0123456789", Roles: allRoles, Expires: time.Now().Add(time.Hour)},
+	}))
+	if err != nil {
+		t.Fatalf("loadTokenStore: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		ts       *tokenStore
+		token    string
+		wantName string // empty if authentication fails
+		has      []role
+		hasNot   []role
+	}{
+		{"worker", ts, "worker-token-0123456789", "worker", []role{roleWorker}, []role{roleViewer, roleSubmitter}},
+		{"viewer and submitter", ts, "admin-token-0123456789", "admin", []role{roleViewer, roleSubmitter}, []role{roleWorker}},
+		{"not expired yet", ts, "later-token-0123456789", "later", allRoles, nil},
+		{"expired", ts, "expired-token-0123456789", "", nil, nil},
+		{"unknown", ts, "unknown-token-0123456789", "", nil, nil},
+		{"prefix of a token", ts, "worker-token", "", nil, nil},
+		{"empty", ts, "", "", nil, nil},
+		{"authentication disabled", nil, "", "anonymous", allRoles, nil},
+		{"authentication disabled ignores token", nil, "worker-token-0123456789", "anonymous", allRoles, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.ts.authenticate(tt.token)
+			if tt.wantName == "" {
+				if err == nil {
+					t.Fatalf("authenticate() = %q, want error", id.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authenticate(): %v", err)
+			}
+			if id.name != tt.wantName {
+				t.Errorf("authenticate() = %q, want %q", id.name, tt.wantName)
+			}
+			for _, r := range tt.has {
+				if err := id.require(r); err != nil {
+					t.Errorf("require(%s): %v", r, err)
+				}
+			}
+			for _, r := range tt.hasNot {
+				if err := id.require(r); err == nil {
+					t.Errorf("require(%s) passed", r)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTokenStoreErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tokenFileEntry
+		wantErr string
+	}{
+		{"empty name", []tokenFileEntry{{Token: "token-0123456789abcdef", Roles: allRoles}}, "name is empty"},
+		{"short token", []tokenFileEntry{{Name: "a", Token: "short", Roles: allRoles}}, "shorter than 16 characters"},
+		{"line break", []tokenFileEntry{{Name: "a", Token: "token-0123456789\nabcdef", Roles: allRoles}}, "line break"},
+		{"unknown role", []tokenFileEntry{{Name: "a", Token: "token-0123456789abcdef", Roles: []role{"admin"}}}, `unknown role "admin"`},
+		{"duplicate token", []tokenFileEntry{
+			{Name: "a", Token: "token-0123456789abcdef", Roles: allRoles},
+			{Name: "b", Token: "token-0123456789abcdef", Roles: allRoles},
+		}, `same as token "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTokenStore(writeTokensFile(t, tt.entries))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadTokenStore() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestTokenStoreValid checks that identities of revoked tokens and tokens with changed roles are invalid after reload
+func TestTokenStoreValid(t *testing.T) {
+	filename := writeTokensFile(t, []tokenFileEntry{
+		{Name: "kept", Token: "kept-token-0123456789", Roles: []role{roleViewer}},
+		{Name: "changed", Token: "changed-token-0123456789", Roles: []role{roleViewer}},
+		{Name: "revoked", Token: "revoked-token-0123456789", Roles: []role{roleViewer}},
+	})
+	ts, err := loadTokenStore(filename)
+	if err != nil {
+		t.Fatalf("loadTokenStore: %v", err)
+	}
+	ids := make(map[string]*identity)
+	for _, token := range []string{"kept-token-0123456789", "changed-token-0123456789", "revoked-token-0123456789"} {
+		id, err := ts.authenticate(token)
+		if err != nil {
+			t.Fatalf("authenticate(%q): %v", token, err)
+		}
+		ids[id.name] = id
+	}
+
+	data, err := json.Marshal([]tokenFileEntry{
+		{Name: "kept", Token: "kept-token-0123456789", Roles: []role{roleViewer}},
+		{Name: "changed", Token: "changed-token-0123456789", Roles: []role{roleViewer, roleSubmitter}},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if err := ts.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	for name, want := range map[string]bool{"kept": true, "changed": false, "revoked": false} {
+		if got := ts.valid(ids[name]); got != want {
+			t.Errorf("valid(%s) = %t, want %t", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+// configEnvPrefix prefixes environment variables overriding the config, e.g. MANDEL_TCP_ADDR for -tcp-addr
+const configEnvPrefix = "MANDEL_"
+
+// config of the server
+// Every field is a flag. It can also be set by environment variable (see configEnvPrefix)
+// and by key of the same name as the flag in json config file given by -config.
+// Flags override environment variables, which override the config file.
+type config struct {
+	// listeners
+	TCPAddr  string
+	HTTPAddr string
+
+	// TLS of both listeners, disabled if TLSCert is empty
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string // requires client certificates signed by this CA on tcp listener (mutual TLS)
+
+	// access tokens, empty disables authentication
+	TokensFile string
+
+	// websocket policy
+	AllowedOrigins        string        // comma separated host patterns, in addition to the server's own host
+	MaxWSConnections      int           // 0 is unlimited
+	MaxWSConnectionsPerIP int           // 0 is unlimited
+	WSPingInterval        time.Duration // 0 disables pings
+
+	// default job, rendered when there is no checkpoint to resume
+	Job          string // one of jobKinds
+	Size         string // WxH
+	Preset       string // name in api.Regions, the start of zoom jobs
+	Palette      string
+	ZoomTo       string // name in api.Regions, the target of zoom jobs
+	ZoomFrames   int
+	DensityKind  string // name in densityKinds
+	DensityUnits int
+	Store        string // one of storeKinds, for image jobs
+	StoreFile    string // file of disk store
+	Output       string // png file of image and density jobs, directory of frames of zoom jobs. Empty doesn't save images
+
+	// scheduler policy
+	TileSize      int
+	MaxTileCopies int // see scheduler.DefaultMaxTileCopies
+
+	// limits
+	MaxSubmittedPixels       int
+	MaxSubmittedJobs         int // unfinished submitted jobs of all clients, 0 is unlimited
+	MaxSubmittedJobsPerToken int // unfinished submitted jobs of clients of a single token, 0 is unlimited
+	SubmittedJobRetention    time.Duration
+	MapTilesCacheSize        int
+	MapTileTimeout           time.Duration
+	TileCacheSize            int64 // 0 disables the tile cache
+
+	// locations
+	StaticDir          string // empty serves embedded files
+	PalettesDir        string
+	PyramidDir         string
+	TileCacheDir       string
+	CheckpointDir      string // empty disables checkpoints
+	CheckpointInterval time.Duration
+
+	// verification of workers' tiles, disabled if VerifyRate is 0
+	VerifyRate           float64
+	VerifyTolerance      int
+	VerifyMaxBadFraction float64
+	QuarantineTime       time.Duration
+
+	// shutdown
+	ShutdownGrace time.Duration
+
+	width, height int             // parsed Size
+	origins       []string        // parsed AllowedOrigins
+	set           map[string]bool // flags set explicitly, by any of the sources
+}
+
+// jobKinds are values of -job
+var jobKinds = []string{"image", "density", "zoom", "expzoom", "pyramid"}
+
+// storeKinds are values of -store
+var storeKinds = []string{"mem", "disk"}
+
+// jobFlags are flags of the default job, which only some kinds of jobs use
+var jobFlags = map[string][]string{
+	"zoom-to":       {"zoom", "expzoom"},
+	"zoom-frames":   {"zoom", "expzoom"},
+	"density-kind":  {"density"},
+	"density-units": {"density"},
+	"store":         {"image"},
+	"store-file":    {"image"},
+}
+
+// defaultConfig returns config with values used when nothing else is set
+func defaultConfig() config {
+	return config{
+		TCPAddr:                  ":8081",
+		HTTPAddr:                 ":8080",
+		Job:                      "image",
+		Size:                     "1920x1080",
+		Preset:                   "seahorse-valley",
+		Palette:                  "hsv",
+		ZoomTo:                   "spiral-minibrot",
+		ZoomFrames:               120,
+		DensityKind:              "nebulabrot",
+		DensityUnits:             100,
+		Store:                    "mem",
+		TileSize:                 scheduler.DefaultTileSize,
+		MaxTileCopies:            scheduler.DefaultMaxTileCopies,
+		MaxSubmittedPixels:       64 << 20,
+		MaxSubmittedJobs:         16,
+		MaxSubmittedJobsPerToken: 4,
+		SubmittedJobRetention:    10 * time.Minute,
+		MapTilesCacheSize:        4096,
+		MapTileTimeout:           10 * time.Second,
+		TileCacheSize:            1 << 30,
+		PalettesDir:              "./palettes",
+		PyramidDir:               "./pyramid",
+		TileCacheDir:             "./tilecache",
+		CheckpointDir:            "./checkpoint",
+		CheckpointInterval:       30 * time.Second,
+		VerifyTolerance:          256,
+		VerifyMaxBadFraction:     0.01,
+		QuarantineTime:           time.Hour,
+		ShutdownGrace:            10 * time.Second,
+		MaxWSConnections:         1024,
+		MaxWSConnectionsPerIP:    32,
+		WSPingInterval:           15 * time.Second,
+	}
+}
+
+// flagSet returns flags setting fields of cfg. Current values of cfg are the defaults.
+func (cfg *config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.String("config", "", "json config file with keys named as flags. Can be set by "+configEnvPrefix+"CONFIG environment variable too")
+
+	fs.StringVar(&cfg.TCPAddr, "tcp-addr", cfg.TCPAddr, "address of irpc tcp listener (cli clients)")
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", cfg.HTTPAddr, "address of http server (web clients, websocket, map tiles)")
+
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "PEM certificate file. Enables TLS on tcp listener and https/wss on http server")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "PEM private key file of -tls-cert")
+	fs.StringVar(&cfg.TLSClientCA, "tls-client-ca", cfg.TLSClientCA, "PEM file of CA certificates. Tcp clients must present certificate signed by one of them (mutual TLS)")
+
+	fs.StringVar(&cfg.TokensFile, "tokens-file", cfg.TokensFile, "json file of access tokens with their roles. Reloaded on SIGHUP. Empty disables authentication")
+
+	fs.StringVar(&cfg.AllowedOrigins, "allowed-origins", cfg.AllowedOrigins, "comma separated origin host patterns (path.Match syntax, e.g. *.example.com) allowed to open websockets, besides the server's own host. * allows any origin")
+	fs.IntVar(&cfg.MaxWSConnections, "max-ws-connections", cfg.MaxWSConnections, "maximal count of websocket connections. 0 is unlimited")
+	fs.IntVar(&cfg.MaxWSConnectionsPerIP, "max-ws-connections-per-ip", cfg.MaxWSConnectionsPerIP, "maximal count of websocket connections from a single IP address. 0 is unlimited")
+	fs.DurationVar(&cfg.WSPingInterval, "ws-ping-interval", cfg.WSPingInterval, "how often websocket clients are pinged. Clients that don't answer within the interval are disconnected. 0 disables pings")
+
+	fs.StringVar(&cfg.Job, "job", cfg.Job, "kind of the default job: "+strings.Join(jobKinds, ", "))
+	fs.StringVar(&cfg.Size, "size", cfg.Size, "size of the default job's image (of zoom frames, of pyramid's full image) as WxH")
+	fs.StringVar(&cfg.Preset, "preset", cfg.Preset, "region of the default job, the start of zoom jobs: "+strings.Join(api.RegionNames(), ", "))
+	fs.StringVar(&cfg.Palette, "palette", cfg.Palette, "palette of the default job and map tiles")
+	fs.StringVar(&cfg.ZoomTo, "zoom-to", cfg.ZoomTo, "region zoom and expzoom jobs zoom to, one of -preset regions")
+	fs.IntVar(&cfg.ZoomFrames, "zoom-frames", cfg.ZoomFrames, "number of frames of zoom and expzoom jobs")
+	fs.StringVar(&cfg.DensityKind, "density-kind", cfg.DensityKind, "kind of density job: "+strings.Join(slices.Sorted(maps.Keys(densityKinds)), ", "))
+	fs.IntVar(&cfg.DensityUnits, "density-units", cfg.DensityUnits, "number of work units of density job, each of them sampling random points")
+	fs.StringVar(&cfg.Store, "store", cfg.Store, "where image job keeps its pixels: mem, or disk for images larger than memory")
+	fs.StringVar(&cfg.StoreFile, "store-file", cfg.StoreFile, "raw pixels file of -store disk. Kept while the job is checkpointed")
+	fs.StringVar(&cfg.Output, "output", cfg.Output, "png file the finished image of image and density jobs is saved to, directory of frames of zoom and expzoom jobs (pyramid job writes to -pyramid-dir)")
+
+	fs.IntVar(&cfg.TileSize, "tile-size", cfg.TileSize, "side of square tiles image jobs are split into, in pixels")
+	fs.IntVar(&cfg.MaxTileCopies, "max-tile-copies", cfg.MaxTileCopies, "maximal number of workers rendering the same tile at once, once no tile is left unstarted. 1 disables duplicate renders")
+
+	fs.IntVar(&cfg.MaxSubmittedPixels, "max-submitted-pixels", cfg.MaxSubmittedPixels, "maximal size of images submitted by clients")
+	fs.IntVar(&cfg.MaxSubmittedJobs, "max-submitted-jobs", cfg.MaxSubmittedJobs, "maximal count of unfinished jobs submitted by all clients. 0 is unlimited")
+	fs.IntVar(&cfg.MaxSubmittedJobsPerToken, "max-submitted-jobs-per-token", cfg.MaxSubmittedJobsPerToken, "maximal count of unfinished jobs submitted by clients of a single access token (all clients, if authentication is disabled). 0 is unlimited")
+	fs.DurationVar(&cfg.SubmittedJobRetention, "submitted-job-retention", cfg.SubmittedJobRetention, "how long finished submitted jobs are kept for download")
+	fs.IntVar(&cfg.MapTilesCacheSize, "map-tiles-cache-size", cfg.MapTilesCacheSize, "number of map tiles kept in memory")
+	fs.DurationVar(&cfg.MapTileTimeout, "map-tile-timeout", cfg.MapTileTimeout, "how long map tile request waits for rendering")
+	fs.Int64Var(&cfg.TileCacheSize, "tile-cache-size", cfg.TileCacheSize, "size of on disk tile cache in bytes. 0 disables the cache")
+
+	fs.StringVar(&cfg.StaticDir, "static-dir", cfg.StaticDir, "directory of web client files, served instead of the files embedded in the binary (for development)")
+	fs.StringVar(&cfg.PalettesDir, "palettes-dir", cfg.PalettesDir, "directory of .map and .ugr palettes")
+	fs.StringVar(&cfg.PyramidDir, "pyramid-dir", cfg.PyramidDir, "directory of Deep Zoom pyramid served on /pyramid/")
+	fs.StringVar(&cfg.TileCacheDir, "tile-cache-dir", cfg.TileCacheDir, "directory of tile cache")
+	fs.StringVar(&cfg.CheckpointDir, "checkpoint-dir", cfg.CheckpointDir, "directory of default job's checkpoint. Empty disables checkpoints")
+	fs.DurationVar(&cfg.CheckpointInterval, "checkpoint-interval", cfg.CheckpointInterval, "how often the default job is checkpointed")
+
+	fs.Float64Var(&cfg.VerifyRate, "verify-rate", cfg.VerifyRate, "fraction of workers' tiles rendered again by the server to check them, from 0 to 1. 0 disables checks")
+	fs.IntVar(&cfg.VerifyTolerance, "verify-tolerance", cfg.VerifyTolerance, "maximal difference of a checked pixel's channel (out of 65535) not counted as a mismatch")
+	fs.Float64Var(&cfg.VerifyMaxBadFraction, "verify-max-bad-fraction", cfg.VerifyMaxBadFraction, "fraction of mismatching pixels a checked tile may have")
+	fs.DurationVar(&cfg.QuarantineTime, "quarantine-time", cfg.QuarantineTime, "how long workers that failed a check get no work")
+
+	fs.DurationVar(&cfg.ShutdownGrace, "shutdown-grace", cfg.ShutdownGrace, "how long workers may finish their tiles on shutdown")
+
+	return fs
+}
+
+// loadConfig returns config given by args, environment and config file, in this order of priority.
+// Invalid values and combinations are reported together.
+func loadConfig(args []string) (config, error) {
+	cfg := defaultConfig()
+	fs := cfg.flagSet()
+
+	// flags are parsed twice. First to find the config file, then to override the file and environment
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	if fs.NArg() > 0 {
+		return config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	filename := fs.Lookup("config").Value.String()
+	if filename == "" {
+		filename = os.Getenv(configEnvPrefix + "CONFIG")
+	}
+	if filename != "" {
+		if err := applyConfigFile(fs, filename); err != nil {
+			return config{}, fmt.Errorf("config file %q: %w", filename, err)
+		}
+	}
+	if err := applyConfigEnv(fs); err != nil {
+		return config{}, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	cfg.set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { cfg.set[f.Name] = true })
+
+	if err := cfg.validate(); err != nil {
+		return config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// applyConfigFile sets flags of fs to values of json object in filename
+func applyConfigFile(fs *flag.FlagSet, filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	// numbers are kept as written, so that they are parsed by the flags
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var values map[string]any
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("dec.Decode: %w", err)
+	}
+
+	var errs []error
+	for name, v := range values {
+		if name == "config" || fs.Lookup(name) == nil {
+			errs = append(errs, fmt.Errorf("unknown key %q", name))
+			continue
+		}
+		if err := fs.Set(name, fmt.Sprint(v)); err != nil {
+			errs = append(errs, fmt.Errorf("key %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyConfigEnv sets flags of fs to values of corresponding environment variables
+func applyConfigEnv(fs *flag.FlagSet) error {
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		name := configEnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, found := os.LookupEnv(name); found {
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: %w", name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// validate checks values and their combinations. It also parses Size.
+func (cfg *config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, a ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	check(cfg.TCPAddr != "", "-tcp-addr is empty")
+	check(cfg.HTTPAddr != "", "-http-addr is empty")
+	check(cfg.TCPAddr != cfg.HTTPAddr, "-tcp-addr and -http-addr are both %q", cfg.TCPAddr)
+	check((cfg.TLSCert == "") == (cfg.TLSKey == ""), "-tls-cert and -tls-key must be set together")
+	check(cfg.TLSClientCA == "" || cfg.TLSCert != "", "-tls-client-ca requires -tls-cert")
+
+	if _, err := fmt.Sscanf(cfg.Size, "%dx%d", &cfg.width, &cfg.height); err != nil || cfg.width <= 0 || cfg.height <= 0 {
+		errs = append(errs, fmt.Errorf("-size %q is not WxH", cfg.Size))
+	}
+	_, found := api.Regions[cfg.Preset]
+	check(found, "-preset %q is unknown, available presets: %s", cfg.Preset, strings.Join(api.RegionNames(), ", "))
+	check(slices.Contains(jobKinds, cfg.Job), "-job %q is unknown, available jobs: %s", cfg.Job, strings.Join(jobKinds, ", "))
+	for name, jobs := range jobFlags {
+		check(!cfg.set[name] || slices.Contains(jobs, cfg.Job), "-%s is not used by -job %s, only by %s", name, cfg.Job, strings.Join(jobs, ", "))
+	}
+	_, found = api.Regions[cfg.ZoomTo]
+	check(found, "-zoom-to %q is unknown, available presets: %s", cfg.ZoomTo, strings.Join(api.RegionNames(), ", "))
+	check(cfg.ZoomFrames >= 1, "-zoom-frames must be at least 1")
+	_, found = densityKinds[cfg.DensityKind]
+	check(found, "-density-kind %q is unknown, available kinds: %s", cfg.DensityKind, strings.Join(slices.Sorted(maps.Keys(densityKinds)), ", "))
+	check(cfg.DensityUnits >= 1, "-density-units must be at least 1")
+	check(slices.Contains(storeKinds, cfg.Store), "-store %q is unknown, available stores: %s", cfg.Store, strings.Join(storeKinds, ", "))
+	check(!cfg.set["checkpoint-dir"] || cfg.CheckpointDir == "" || cfg.Job == "image", "-checkpoint-dir is set, but -job %s is not checkpointed, only image jobs are", cfg.Job)
+	check(cfg.Store != "disk" || cfg.StoreFile != "", "-store disk requires -store-file")
+	check(cfg.StoreFile == "" || cfg.Store == "disk", "-store-file requires -store disk")
+	check(cfg.Output != "" || (cfg.Job != "zoom" && cfg.Job != "expzoom"), "-job %s requires -output directory of frames", cfg.Job)
+	check(cfg.Output == "" || cfg.Job != "pyramid", "-job pyramid writes to -pyramid-dir, -output is not used")
+	check(cfg.PyramidDir != "" || cfg.Job != "pyramid", "-job pyramid requires -pyramid-dir")
+
+	check(cfg.TileSize >= 8 && cfg.TileSize <= 1024, "-tile-size %d is out of range 8..1024", cfg.TileSize)
+	check(cfg.MaxTileCopies >= 1, "-max-tile-copies must be at least 1")
+
+	check(cfg.MaxSubmittedPixels > 0, "-max-submitted-pixels must be positive")
+	check(cfg.MaxSubmittedJobs >= 0, "-max-submitted-jobs must not be negative")
+	check(cfg.MaxSubmittedJobsPerToken >= 0, "-max-submitted-jobs-per-token must not be negative")
+	check(cfg.MaxSubmittedJobs == 0 || cfg.MaxSubmittedJobsPerToken <= cfg.MaxSubmittedJobs, "-max-submitted-jobs-per-token %d is above -max-submitted-jobs %d", cfg.MaxSubmittedJobsPerToken, cfg.MaxSubmittedJobs)
+	check(cfg.SubmittedJobRetention >= 0, "-submitted-job-retention must not be negative")
+	check(cfg.MapTilesCacheSize > 0, "-map-tiles-cache-size must be positive")
+	check(cfg.MapTileTimeout > 0, "-map-tile-timeout must be positive")
+	check(cfg.TileCacheSize >= 0, "-tile-cache-size must not be negative")
+	check(cfg.TileCacheSize == 0 || cfg.TileCacheDir != "", "-tile-cache-dir is empty, while -tile-cache-size is %d", cfg.TileCacheSize)
+	check(cfg.CheckpointDir == "" || cfg.CheckpointInterval > 0, "-checkpoint-interval must be positive")
+	check(cfg.VerifyRate >= 0 && cfg.VerifyRate <= 1, "-verify-rate %g is out of range 0..1", cfg.VerifyRate)
+	check(cfg.VerifyTolerance >= 0, "-verify-tolerance must not be negative")
+	check(cfg.VerifyMaxBadFraction >= 0 && cfg.VerifyMaxBadFraction < 1, "-verify-max-bad-fraction %g is out of range 0..1", cfg.VerifyMaxBadFraction)
+	check(cfg.QuarantineTime >= 0, "-quarantine-time must not be negative")
+	check(cfg.ShutdownGrace >= 0, "-shutdown-grace must not be negative")
+	check(cfg.MaxWSConnections >= 0, "-max-ws-connections must not be negative")
+	check(cfg.MaxWSConnectionsPerIP >= 0, "-max-ws-connections-per-ip must not be negative")
+	check(cfg.WSPingInterval >= 0, "-ws-ping-interval must not be negative")
+
+	cfg.origins = nil
+	for _, pattern := range strings.Split(cfg.AllowedOrigins, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("-allowed-origins pattern %q: %w", pattern, err))
+		}
+		cfg.origins = append(cfg.origins, pattern)
+	}
+
+	if cfg.StaticDir != "" {
+		if fi, err := os.Stat(cfg.StaticDir); err != nil || !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("-static-dir %q is not a directory", cfg.StaticDir))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadConfigPrecedence checks that flags override environment variables, which override the config file
+func TestLoadConfigPrecedence(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(`{"tcp-addr": ":1001", "http-addr": ":1002", "tile-size": 128, "palette": "fire"}`), 0o600); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	t.Setenv(configEnvPrefix+"CONFIG", filename)
+	t.Setenv(configEnvPrefix+"HTTP_ADDR", ":2002")
+	t.Setenv(configEnvPrefix+"TILE_SIZE", "256")
+
+	cfg, err := loadConfig([]string{"-tile-size", "32"})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.TCPAddr != ":1001" {
+		t.Errorf("-tcp-addr of the file = %q, want :1001", cfg.TCPAddr)
+	}
+	if cfg.HTTPAddr != ":2002" {
+		t.Errorf("-http-addr of the environment = %q, want :2002", cfg.HTTPAddr)
+	}
+	if cfg.TileSize != 32 {
+		t.Errorf("-tile-size of the flag = %d, want 32", cfg.TileSize)
+	}
+	if cfg.Palette != "fire" {
+		t.Errorf("-palette of the file = %q, want fire", cfg.Palette)
+	}
+	if cfg.Size != defaultConfig().Size {
+		t.Errorf("default -size = %q, want %q", cfg.Size, defaultConfig().Size)
+	}
+	for _, name := range []string{"tcp-addr", "http-addr", "tile-size", "palette"} {
+		if !cfg.set[name] {
+			t.Errorf("-%s is not set", name)
+		}
+	}
+	if cfg.set["size"] {
+		t.Error("default -size is set")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string // content of config file, if not empty
+		wantErr string
+	}{
+		{"same addresses", []string{"-tcp-addr", ":1", "-http-addr", ":1"}, nil, "", "-tcp-addr and -http-addr are both"},
+		{"tls key without cert", []string{"-tls-key", "key.pem"}, nil, "", "-tls-cert and -tls-key must be set together"},
+		{"bad size", []string{"-size", "100"}, nil, "", "-size \"100\" is not WxH"},
+		{"unknown preset", []string{"-preset", "nowhere"}, nil, "", "-preset \"nowhere\" is unknown"},
+		{"unknown job", []string{"-job", "movie"}, nil, "", "-job \"movie\" is unknown"},
+		{"flag of another job", []string{"-zoom-frames", "10"}, nil, "", "-zoom-frames is not used by -job image"},
+		{"flag of another job in file", nil, nil, `{"density-units": 10}`, "-density-units is not used by -job image"},
+		{"checkpoint of another job", []string{"-job", "density", "-checkpoint-dir", "cp"}, nil, "", "-job density is not checkpointed"},
+		{"disk store without file", []string{"-store", "disk"}, nil, "", "-store disk requires -store-file"},
+		{"zoom without output", []string{"-job", "zoom"}, nil, "", "-job zoom requires -output"},
+		{"tile size", []string{"-tile-size", "4"}, nil, "", "-tile-size 4 is out of range"},
+		{"jobs per token over jobs", []string{"-max-submitted-jobs", "2", "-max-submitted-jobs-per-token", "3"}, nil, "", "is above -max-submitted-jobs"},
+		{"verify rate", nil, map[string]string{"VERIFY_RATE": "2"}, "", "-verify-rate 2 is out of range"},
+		{"bad environment value", nil, map[string]string{"TILE_SIZE": "big"}, "", "environment variable MANDEL_TILE_SIZE"},
+		{"unknown file key", nil, nil, `{"tile-sizes": 10}`, `unknown key "tile-sizes"`},
+		{"bad origin pattern", []string{"-allowed-origins", "[a"}, nil, "", "-allowed-origins pattern"},
+		{"unexpected argument", []string{"serve"}, nil, "", "unexpected arguments: serve"},
+		{"unknown flag", []string{"-tiles"}, nil, "", "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, v := range tt.env {
+				t.Setenv(configEnvPrefix+name, v)
+			}
+			if tt.file != "" {
+				filename := filepath.Join(t.TempDir(), "config.json")
+				if err := os.WriteFile(filename, []byte(tt.file), 0o600); err != nil {
+					t.Fatalf("os.WriteFile: %v", err)
+				}
+				t.Setenv(configEnvPrefix+"CONFIG", filename)
+			}
+			_, err := loadConfig(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadConfig() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestLoadConfigReportsAllErrors checks that all invalid values are reported at once
+func TestLoadConfigReportsAllErrors(t *testing.T) {
+	_, err := loadConfig([]string{"-tile-size", "4", "-max-tile-copies", "0", "-verify-rate", "-1"})
+	if err == nil {
+		t.Fatal("loadConfig passed")
+	}
+	for _, want := range []string{"-tile-size", "-max-tile-copies", "-verify-rate"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %s", err, want)
+		}
+	}
+}
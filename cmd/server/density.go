@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"maps"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+// Buddhabrot style jobs
+var (
+	// Buddhabrot – orbits escaping within 2000 iterations
+	Buddhabrot = api.DensityJob{
+		Samples:  200_000,
+		MinIter:  20,
+		MaxIters: []int{2000},
+	}
+
+	// Nebulabrot – red, green and blue channels with decreasing iteration limits
+	Nebulabrot = api.DensityJob{
+		Samples:  200_000,
+		MinIter:  10,
+		MaxIters: []int{5000, 500, 50},
+	}
+)
+
+// densityKinds are density jobs by name, see -density-kind
+var densityKinds = map[string]api.DensityJob{
+	"buddhabrot": Buddhabrot,
+	"nebulabrot": Nebulabrot,
+}
+
+var _ renderJob = &densityWorkScheduler{}
+
+// densityWorkScheduler manages work on single Buddhabrot image rendering.
+// Workers sample random points and return density grids, which are summed up.
+// Image is colorized once all units are done.
+// densityWorkScheduler provides its image for api.ImgProvider and implements most of api.TileProvider
+type densityWorkScheduler struct {
+	job api.DensityJob
+	sum []uint64 // summed density grids of all finished units
+	img *image.RGBA64
+
+	tiles map[image.Rectangle]struct{}
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+
+	// units are identified by seed of the random generator
+	unstartedUnits map[uint64]struct{}
+	inProcessUnits map[uint64]struct{}
+	finishedUnits  map[uint64]struct{}
+	unitsCount     int
+	m              sync.Mutex
+}
+
+// newDensityWorkScheduler creates w×h density job of given region, split into units work units.
+func newDensityWorkScheduler(w, h int, region api.MandelRegion, job api.DensityJob, units int) *densityWorkScheduler {
+	job.Region = region
+	job.W, job.H = w, h
+
+	unstarted := make(map[uint64]struct{}, units)
+	for seed := range uint64(units) {
+		unstarted[seed] = struct{}{}
+	}
+
+	tiles := make(map[image.Rectangle]struct{})
+	for _, t := range scheduler.SplitRectNoClip(image.Rect(0, 0, w, h), 64, 64) {
+		tiles[t] = struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &densityWorkScheduler{
+		job:            job,
+		sum:            make([]uint64, w*h*len(job.MaxIters)),
+		img:            image.NewRGBA64(image.Rect(0, 0, w, h)),
+		tiles:          tiles,
+		ctx:            ctx,
+		ctxCancel:      cancel,
+		unstartedUnits: unstarted,
+		inProcessUnits: make(map[uint64]struct{}),
+		finishedUnits:  make(map[uint64]struct{}, units),
+		unitsCount:     units,
+	}
+}
+
+// FinishedTiles implements api.TileProvider
+// density image is known only once all units are finished, so all tiles finish at once
+func (dws *densityWorkScheduler) FinishedTiles() (map[image.Rectangle]struct{}, error) {
+	select {
+	case <-dws.ctx.Done():
+		return maps.Clone(dws.tiles), nil
+	default:
+		return map[image.Rectangle]struct{}{}, nil
+	}
+}
+
+// GetTileImg implements api.TileProvider
+func (dws *densityWorkScheduler) GetTileImg(rect image.Rectangle) (*image.RGBA, error) {
+	dws.m.Lock()
+	defer dws.m.Unlock()
+
+	return scheduler.CopyTile(dws.img, rect), nil
+}
+
+// FullImageDimensions implements api.TileProvider
+func (dws *densityWorkScheduler) FullImageDimensions() (width, height int, err error) {
+	return dws.job.W, dws.job.H, nil
+}
+
+// TotalTilesCount implements api.TileProvider
+func (dws *densityWorkScheduler) TotalTilesCount() (int, error) {
+	return len(dws.tiles), nil
+}
+
+// Frames implements api.TileProvider
+func (dws *densityWorkScheduler) Frames() (current, total int, err error) {
+	return 0, 1, nil
+}
+
+// GetImage implements renderJob
+// blocks until all units are finished
+func (dws *densityWorkScheduler) GetImage() (*image.RGBA64, error) {
+	<-dws.ctx.Done()
+	return dws.img, nil
+}
+
+// Progress implements renderJob
+func (dws *densityWorkScheduler) Progress() (float64, error) {
+	dws.m.Lock()
+	defer dws.m.Unlock()
+
+	return float64(len(dws.finishedUnits)) / float64(dws.unitsCount), nil
+}
+
+// GetImageRows implements renderJob
+// density image is known only once all units are finished
+func (dws *densityWorkScheduler) GetImageRows(ctx context.Context, y, n int) (*image.RGBA64, error) {
+	return finalImageRows(ctx, dws, y, n)
+}
+
+// Done implements renderJob
+func (dws *densityWorkScheduler) Done() <-chan struct{} {
+	return dws.ctx.Done()
+}
+
+// PopWork implements scheduler.WorkSource
+// unit of work is a single RenderDensity call
+func (dws *densityWorkScheduler) PopWork() (scheduler.WorkUnit, bool) {
+	seed, found := dws.popUnit()
+	if !found {
+		return nil, false
+	}
+	return func(ctx context.Context, renderer api.Renderer) error {
+		grid, err := renderer.RenderDensity(dws.job, seed)
+		if err != nil {
+			return fmt.Errorf("density render of unit %d failed: %w", seed, err)
+		}
+		if grid.W != dws.job.W || grid.H != dws.job.H || grid.Channels != len(dws.job.MaxIters) {
+			return fmt.Errorf("density unit %d: unexpected grid %dx%dx%d", seed, grid.W, grid.H, grid.Channels)
+		}
+		if err := dws.mergeUnit(seed, grid); err != nil {
+			return fmt.Errorf("density unit %d: %w", seed, err)
+		}
+		return nil
+	}, true
+}
+
+// popUnit returns seed of unit to be rendered
+// once there are no unstarted units, units in process are handed out again
+func (dws *densityWorkScheduler) popUnit() (seed uint64, found bool) {
+	dws.m.Lock()
+	defer dws.m.Unlock()
+
+	for seed = range dws.unstartedUnits {
+		delete(dws.unstartedUnits, seed)
+		dws.inProcessUnits[seed] = struct{}{}
+		return seed, true
+	}
+
+	for seed = range dws.inProcessUnits {
+		return seed, true
+	}
+
+	return 0, false
+}
+
+// mergeUnit is the reduction step: it adds grid to the summed density
+// the image is colorized once the last unit is merged
+// malformed grid returns error, the unit then stays in process
+func (dws *densityWorkScheduler) mergeUnit(seed uint64, grid *api.DensityGrid) error {
+	dws.m.Lock()
+	defer dws.m.Unlock()
+
+	if _, found := dws.inProcessUnits[seed]; !found {
+		// unit was already merged from another worker. counting it twice would skew the density
+		return nil
+	}
+	if err := render.AddDensity(dws.sum, grid); err != nil {
+		return fmt.Errorf("render.AddDensity: %w", err)
+	}
+	delete(dws.inProcessUnits, seed)
+	dws.finishedUnits[seed] = struct{}{}
+	log.Printf("density: %d/%d units", len(dws.finishedUnits), dws.unitsCount)
+
+	if len(dws.unstartedUnits) == 0 && len(dws.inProcessUnits) == 0 {
+		dws.img = render.ColorizeDensity(dws.sum, dws.job.W, dws.job.H, len(dws.job.MaxIters))
+		dws.ctxCancel()
+	}
+	return nil
+}
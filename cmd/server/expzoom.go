@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"log"
+	"math"
+	"path/filepath"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+// expMapMargin is the extra zoom rendered below the last frame's corners.
+// Pixels closer to the last frame's center than 1/expMapMargin of its corner distance are clamped to the strip's last row.
+const expMapMargin = 64
+
+var _ renderJob = &expZoomJob{}
+
+// expZoomJob renders zoom animation from a single exponential map strip.
+// Workers render only the strip (it is an ordinary image job with api.MappingExp),
+// zoom frames are unwarped from it locally once it is finished, with no further worker calls.
+// Zoom is centered at the target region center, starting with the size of the start region.
+// GetImage returns the strip.
+type expZoomJob struct {
+	*scheduler.ImgWorkScheduler // renders the strip
+
+	stripRegion    api.MandelRegion
+	frameW, frameH int
+	frames         int
+	zoom           float64 // zoom factor between the first and the last frame
+	outDir         string
+}
+
+// newExpZoomJob creates zoom animation of frames w×h images from region from to region to.
+func newExpZoomJob(w, h int, from, to api.MandelRegion, frames int, params api.RenderParams, outDir string, tileSize, maxCopies int, cache *scheduler.TileCache) *expZoomJob {
+	frames = max(frames, 1)
+
+	// strip is centered at the target, with the size of the first frame
+	cx, cy := (to.Xmin+to.Xmax)/2, (to.Ymin+to.Ymax)/2
+	halfW, halfH := (from.Xmax-from.Xmin)/2, (from.Ymax-from.Ymin)/2
+	stripRegion := api.MandelRegion{Xmin: cx - halfW, Xmax: cx + halfW, Ymin: cy - halfH, Ymax: cy + halfH}
+	zoom := (from.Xmax - from.Xmin) / (to.Xmax - to.Xmin)
+
+	// strip's width matches circumference of the circle through frame corners
+	stripW := int(math.Ceil(math.Pi * math.Hypot(float64(w), float64(h))))
+	stripH := render.ExpMapDepth(stripW, zoom*expMapMargin)
+
+	params.Mapping = api.MappingExp
+	ezj := &expZoomJob{
+		ImgWorkScheduler: scheduler.NewImgWorkScheduler(scheduler.NewMemTileStore(stripW, stripH), stripRegion, params, tileSize, maxCopies, cache),
+		stripRegion:      stripRegion,
+		frameW:           w,
+		frameH:           h,
+		frames:           frames,
+		zoom:             zoom,
+		outDir:           outDir,
+	}
+	log.Printf("exp zoom: strip %dx%d for %d frames of %dx%d", stripW, stripH, frames, w, h)
+
+	go ezj.unwarpWhenRendered()
+
+	return ezj
+}
+
+// unwarpWhenRendered waits for the strip and unwarps it into frames
+func (ezj *expZoomJob) unwarpWhenRendered() {
+	strip, _ := ezj.GetImage()
+
+	gifFrames := make([]*image.Paletted, ezj.frames)
+	for i := range ezj.frames {
+		frame := ezj.unwarpFrame(strip, i)
+
+		name := filepath.Join(ezj.outDir, fmt.Sprintf("frame_%05d.png", i))
+		if err := savePNG(name, frame); err != nil {
+			log.Printf("exp zoom: save frame %d: %v", i, err)
+		}
+
+		gifFrames[i] = image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(gifFrames[i], frame.Bounds(), frame, image.Point{})
+	}
+	log.Printf("exp zoom: %d frames saved to %q", ezj.frames, ezj.outDir)
+
+	gifName := filepath.Join(ezj.outDir, "zoom.gif")
+	if err := saveGIF(gifName, gifFrames); err != nil {
+		log.Printf("exp zoom: save animation: %v", err)
+		return
+	}
+	log.Printf("exp zoom: animation saved to %q", gifName)
+}
+
+// unwarpFrame samples frame i from the strip
+func (ezj *expZoomJob) unwarpFrame(strip *image.RGBA64, i int) *image.RGBA64 {
+	t := 0.0
+	if ezj.frames > 1 {
+		t = float64(i) / float64(ezj.frames-1)
+	}
+	scale := math.Pow(ezj.zoom, -t)
+
+	r := ezj.stripRegion
+	cx, cy := (r.Xmin+r.Xmax)/2, (r.Ymin+r.Ymax)/2
+	frameW, frameH := (r.Xmax-r.Xmin)*scale, (r.Ymax-r.Ymin)*scale
+
+	frame := image.NewRGBA64(image.Rect(0, 0, ezj.frameW, ezj.frameH))
+	for y := range ezj.frameH {
+		for x := range ezj.frameW {
+			c := complex(
+				cx+(float64(x)/float64(ezj.frameW)-0.5)*frameW,
+				cy+(float64(y)/float64(ezj.frameH)-0.5)*frameH,
+			)
+			px, py := render.ExpMapPixel(r, strip.Rect.Dx(), c)
+			frame.SetRGBA64(x, y, sampleBilinear(strip, px, py))
+		}
+	}
+	return frame
+}
+
+// sampleBilinear returns color of img at fractional coordinates x, y
+// x wraps around (exp map strip is periodic horizontally), y is clamped
+func sampleBilinear(img *image.RGBA64, x, y float64) color.RGBA64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	y = min(max(y, 0), float64(h-1))
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix0 := (int(x0)%w + w) % w
+	ix1 := (ix0 + 1) % w
+	iy0 := int(y0)
+	iy1 := min(iy0+1, h-1)
+
+	c00, c10 := img.RGBA64At(ix0, iy0), img.RGBA64At(ix1, iy0)
+	c01, c11 := img.RGBA64At(ix0, iy1), img.RGBA64At(ix1, iy1)
+
+	mix := func(a, b, c, d uint16) uint16 {
+		top := lerp(float64(a), float64(b), fx)
+		bottom := lerp(float64(c), float64(d), fx)
+		return uint16(math.Round(lerp(top, bottom, fy)))
+	}
+	return color.RGBA64{
+		R: mix(c00.R, c10.R, c01.R, c11.R),
+		G: mix(c00.G, c10.G, c01.G, c11.G),
+		B: mix(c00.B, c10.B, c01.B, c11.B),
+		A: mix(c00.A, c10.A, c01.A, c11.A),
+	}
+}
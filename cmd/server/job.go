@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+var _ renderJob = &scheduler.ImgWorkScheduler{}
+
+// renderJob is a job distributed among workers of scheduler.WorkPool.
+// It provides its progress to web clients and the final image to cli clients.
+type renderJob interface {
+	scheduler.WorkSource
+
+	// following methods match api.ImgProvider for a single job, which is chosen by jobRegistry
+	GetImage() (*image.RGBA64, error)
+	Progress() (float64, error)
+	GetImageRows(ctx context.Context, y, n int) (*image.RGBA64, error)
+
+	// following methods match api.TileProvider. Workers count is provided by scheduler.WorkPool
+	FinishedTiles() (map[image.Rectangle]struct{}, error)
+	GetTileImg(rect image.Rectangle) (*image.RGBA, error)
+	FullImageDimensions() (width, height int, err error)
+	TotalTilesCount() (int, error)
+	Frames() (current, total int, err error)
+
+	// Done is closed once the job is finished
+	Done() <-chan struct{}
+}
+
+// newDefaultJob returns the job given by cfg.Job. Image job is returned as imgJob too.
+// Image job checkpointed in cfg.CheckpointDir is resumed, unless the checkpoint is of a different job than cfg.
+func newDefaultJob(cfg config, params api.RenderParams, cache *scheduler.TileCache) (job renderJob, imgJob *scheduler.ImgWorkScheduler, err error) {
+	region := api.Regions[cfg.Preset]
+	switch cfg.Job {
+	case "density":
+		// accumulated from cfg.DensityUnits units of random samples
+		return newDensityWorkScheduler(cfg.width, cfg.height, region, densityKinds[cfg.DensityKind], cfg.DensityUnits), nil, nil
+	case "zoom":
+		return newZoomWorkScheduler(cfg.width, cfg.height, region, api.Regions[cfg.ZoomTo], cfg.ZoomFrames, params, cfg.Output, cfg.TileSize, cfg.MaxTileCopies, cache), nil, nil
+	case "expzoom":
+		// the same zoom from a single exponential map strip, which is much cheaper
+		return newExpZoomJob(cfg.width, cfg.height, region, api.Regions[cfg.ZoomTo], cfg.ZoomFrames, params, cfg.Output, cfg.TileSize, cfg.MaxTileCopies, cache), nil, nil
+	case "pyramid":
+		// explored on pyramid.html
+		return newPyramidJob(cfg.width, cfg.height, region, params, cfg.PyramidDir, cfg.MaxTileCopies), nil, nil
+	}
+
+	if cfg.CheckpointDir != "" {
+		imgJob, err = scheduler.ResumeImgWorkScheduler(cfg.CheckpointDir, cfg.MaxTileCopies, cache)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scheduler.ResumeImgWorkScheduler: %w", err)
+		}
+		if imgJob != nil && !imgJob.IsJob(cfg.width, cfg.height, region, params, cfg.TileSize, cfg.StoreFile) {
+			imgJob.CloseStore()
+			return nil, nil, fmt.Errorf("checkpoint in %q is of a different job than given by -size, -preset, -palette, -tile-size and -store-file (see its job.json): run with the same flags to resume it, or remove the checkpoint to start the new job", cfg.CheckpointDir)
+		}
+		if imgJob != nil {
+			return imgJob, imgJob, nil
+		}
+	}
+
+	// disk store keeps images larger than memory in -store-file
+	var store scheduler.TileStore
+	if cfg.Store == "disk" {
+		diskStore, err := scheduler.NewDiskTileStore(cfg.StoreFile, cfg.width, cfg.height)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scheduler.NewDiskTileStore: %w", err)
+		}
+		store = diskStore
+	} else {
+		store = scheduler.NewMemTileStore(cfg.width, cfg.height)
+	}
+	imgJob = scheduler.NewImgWorkScheduler(store, region, params, cfg.TileSize, cfg.MaxTileCopies, cache)
+	return imgJob, imgJob, nil
+}
+
+// saveOutput waits for job to finish and saves its image to cfg.Output as png.
+// Image job's image is streamed, so that disk store is never read into memory.
+// Zoom and pyramid jobs save their images themselves.
+func saveOutput(cfg config, job renderJob, imgJob *scheduler.ImgWorkScheduler) {
+	switch {
+	case cfg.Output == "":
+	case imgJob != nil:
+		imgJob.SavePNGWhenRendered(cfg.Output)
+	case cfg.Job == "density":
+		<-job.Done()
+		img, err := job.GetImage()
+		if err == nil {
+			err = savePNG(cfg.Output, img)
+		}
+		if err != nil {
+			log.Printf("save %q: %v", cfg.Output, err)
+			return
+		}
+		log.Printf("image saved to %q", cfg.Output)
+	}
+}
+
+var _ api.TileProvider = jobTileProvider{}
+
+// jobTileProvider implements api.TileProvider for a job rendered by workers of pool
+type jobTileProvider struct {
+	renderJob
+	pool *scheduler.WorkPool
+}
+
+// WorkersCount implements api.TileProvider
+func (jtp jobTileProvider) WorkersCount() (int, error) {
+	return jtp.pool.WorkersCount()
+}
+
+// finalImageRows implements GetImageRows for jobs, whose image is known only once they are finished.
+// It waits for the job to finish and returns rows y..y+n-1 of its image.
+func finalImageRows(ctx context.Context, job renderJob, y, n int) (*image.RGBA64, error) {
+	select {
+	case <-job.Done():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	img, err := job.GetImage()
+	if err != nil {
+		return nil, err
+	}
+	rows := scheduler.RowsRect(img.Rect, y, n)
+	if rows.Empty() {
+		return nil, fmt.Errorf("rows %d..%d out of image %s", y, y+n-1, img.Rect)
+	}
+	rowsImg := image.NewRGBA64(rows)
+	draw.Draw(rowsImg, rows, img, rows.Min, draw.Src)
+	return rowsImg, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+var _ api.ImgProvider = &jobRegistry{}
+
+// jobRegistry is a registry of jobs rendered by workers of pool.
+// It holds the server's own job and jobs submitted by clients, which are forgotten some time after they are finished.
+// jobRegistry implements api.ImgProvider
+type jobRegistry struct {
+	pool  *scheduler.WorkPool
+	cache *scheduler.TileCache
+
+	tileSize      int
+	maxTileCopies int
+	// maxPixels limits size of submitted images, which are held in memory
+	maxPixels int
+	// retention is how long finished submitted jobs wait for their clients to download the image
+	retention time.Duration
+	// maxActive and maxActivePerToken limit unfinished submitted jobs, 0 is unlimited
+	maxActive         int
+	maxActivePerToken int
+
+	jobs        map[api.JobID]renderJob
+	active      map[[sha256.Size]byte]int // unfinished submitted jobs by key of their submitter's token, see identity
+	activeTotal int
+	nextID      api.JobID
+	m           sync.Mutex
+}
+
+var _ api.ImgProvider = clientJobs{}
+
+// clientJobs is jobRegistry as seen by a client. Jobs it submits count to the limit of its token.
+type clientJobs struct {
+	*jobRegistry
+	id *identity
+}
+
+// newJobRegistry creates registry with serverJob as api.ServerJobID.
+// serverJob is expected to be added to the pool already.
+// Submitted jobs are split into tiles and limited as given by cfg.
+func newJobRegistry(pool *scheduler.WorkPool, cache *scheduler.TileCache, serverJob renderJob, cfg config) *jobRegistry {
+	return &jobRegistry{
+		pool:              pool,
+		cache:             cache,
+		tileSize:          cfg.TileSize,
+		maxTileCopies:     cfg.MaxTileCopies,
+		maxPixels:         cfg.MaxSubmittedPixels,
+		retention:         cfg.SubmittedJobRetention,
+		maxActive:         cfg.MaxSubmittedJobs,
+		maxActivePerToken: cfg.MaxSubmittedJobsPerToken,
+		jobs:              map[api.JobID]renderJob{api.ServerJobID: serverJob},
+		active:            make(map[[sha256.Size]byte]int),
+		nextID:            api.ServerJobID + 1,
+	}
+}
+
+// forClient returns the registry as seen by client id
+func (js *jobRegistry) forClient(id *identity) clientJobs {
+	return clientJobs{jobRegistry: js, id: id}
+}
+
+// SubmitJob implements api.ImgProvider
+func (cj clientJobs) SubmitJob(region api.MandelRegion, w, h int, params api.RenderParams) (api.JobID, error) {
+	return cj.submitJob(cj.id, region, w, h, params)
+}
+
+// SubmitJob implements api.ImgProvider. The job is submitted as anonymous client, see clientJobs
+func (js *jobRegistry) SubmitJob(region api.MandelRegion, w, h int, params api.RenderParams) (api.JobID, error) {
+	return js.submitJob(anonymous, region, w, h, params)
+}
+
+// submitJob starts job submitted by client id
+// submitted jobs get workers once the jobs submitted earlier have nothing more to hand out
+func (js *jobRegistry) submitJob(id *identity, region api.MandelRegion, w, h int, params api.RenderParams) (api.JobID, error) {
+	if w <= 0 || h <= 0 || w > js.maxPixels/h {
+		return 0, fmt.Errorf("invalid image size %dx%d, at most %d pixels are allowed", w, h, js.maxPixels)
+	}
+	if err := region.Validate(); err != nil {
+		return 0, err
+	}
+	if err := validateParams(params); err != nil {
+		return 0, err
+	}
+
+	// the job is counted before its image is allocated, so that rejected jobs cost nothing
+	if err := js.reserve(id); err != nil {
+		return 0, err
+	}
+	job := scheduler.NewImgWorkScheduler(scheduler.NewMemTileStore(w, h), region, params, js.tileSize, js.maxTileCopies, js.cache)
+
+	js.m.Lock()
+	jobID := js.nextID
+	js.nextID++
+	js.jobs[jobID] = job
+	js.m.Unlock()
+
+	js.pool.AddSource(job)
+	log.Printf("job %d: submitted %dx%d image of %+v by %q", jobID, w, h, region, id.name)
+
+	go js.forgetWhenDone(jobID, job, id)
+
+	return jobID, nil
+}
+
+// reserve counts a new unfinished job of client id, unless a limit of unfinished jobs is reached
+func (js *jobRegistry) reserve(id *identity) error {
+	js.m.Lock()
+	defer js.m.Unlock()
+
+	if js.maxActive > 0 && js.activeTotal >= js.maxActive {
+		return fmt.Errorf("server renders %d submitted jobs already, which is its limit. Submit again once some of them are finished", js.activeTotal)
+	}
+	if js.maxActivePerToken > 0 && js.active[id.key] >= js.maxActivePerToken {
+		return fmt.Errorf("%q has %d unfinished jobs already, which is the limit of a token. Submit again once some of them are finished", id.name, js.active[id.key])
+	}
+	js.active[id.key]++
+	js.activeTotal++
+	return nil
+}
+
+// release uncounts unfinished job of client id
+func (js *jobRegistry) release(id *identity) {
+	js.m.Lock()
+	defer js.m.Unlock()
+
+	js.activeTotal--
+	if js.active[id.key]--; js.active[id.key] == 0 {
+		delete(js.active, id.key)
+	}
+}
+
+// validateParams returns error if any number of params is NaN or infinite
+func validateParams(p api.RenderParams) error {
+	if !finite(p.Trap.X, p.Trap.Y, p.Trap.Radius, p.Trap.Angle) {
+		return fmt.Errorf("invalid trap %+v: numbers must be finite", p.Trap)
+	}
+	if !finite(p.TrapWeight, p.PaletteCycle, p.PaletteOffset) {
+		return fmt.Errorf("invalid trap weight %g, palette cycle %g or palette offset %g: numbers must be finite", p.TrapWeight, p.PaletteCycle, p.PaletteOffset)
+	}
+	for i, s := range p.Palette.Stops {
+		if !finite(s.Pos) {
+			return fmt.Errorf("invalid position %g of palette stop %d: must be finite", s.Pos, i)
+		}
+	}
+	return nil
+}
+
+// finite returns true if none of values is NaN or infinite
+func finite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// forgetWhenDone removes the job once it is finished and its image had time to be downloaded.
+// Cancelled job is removed right away. The job stops counting to the limits of its submitter once it is done.
+func (js *jobRegistry) forgetWhenDone(id api.JobID, job *scheduler.ImgWorkScheduler, submitter *identity) {
+	<-job.Done()
+	js.release(submitter)
+	js.pool.RemoveSource(job)
+	if job.Cancelled() {
+		log.Printf("job %d: cancelled", id)
+	} else {
+		log.Printf("job %d: finished", id)
+		time.Sleep(js.retention)
+	}
+
+	js.m.Lock()
+	delete(js.jobs, id)
+	js.m.Unlock()
+	log.Printf("job %d: forgotten", id)
+}
+
+// job returns job of given id
+func (js *jobRegistry) job(id api.JobID) (renderJob, error) {
+	js.m.Lock()
+	defer js.m.Unlock()
+
+	job, found := js.jobs[id]
+	if !found {
+		return nil, fmt.Errorf("unknown job %d", id)
+	}
+	return job, nil
+}
+
+// GetImage implements api.ImgProvider
+func (js *jobRegistry) GetImage(id api.JobID) (*image.RGBA64, error) {
+	job, err := js.job(id)
+	if err != nil {
+		return nil, err
+	}
+	return job.GetImage()
+}
+
+// FullImageDimensions implements api.ImgProvider
+func (js *jobRegistry) FullImageDimensions(id api.JobID) (width, height int, err error) {
+	job, err := js.job(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	return job.FullImageDimensions()
+}
+
+// Progress implements api.ImgProvider
+func (js *jobRegistry) Progress(id api.JobID) (float64, error) {
+	job, err := js.job(id)
+	if err != nil {
+		return 0, err
+	}
+	return job.Progress()
+}
+
+// GetImageRows implements api.ImgProvider
+func (js *jobRegistry) GetImageRows(ctx context.Context, id api.JobID, y, n int) (*image.RGBA64, error) {
+	job, err := js.job(id)
+	if err != nil {
+		return nil, err
+	}
+	return job.GetImageRows(ctx, y, n)
+}
+
+// CancelJob implements api.ImgProvider
+func (js *jobRegistry) CancelJob(id api.JobID) error {
+	if id == api.ServerJobID {
+		return errors.New("server's job can't be cancelled")
+	}
+	j, err := js.job(id)
+	if err != nil {
+		return err
+	}
+	// all submitted jobs are images
+	job := j.(*scheduler.ImgWorkScheduler)
+	if job.Cancelled() {
+		return nil
+	}
+	select {
+	case <-job.Done():
+		return fmt.Errorf("job %d is already finished", id)
+	default:
+	}
+	job.Cancel()
+	return nil
+}
+
+// Jobs implements api.ImgProvider
+func (js *jobRegistry) Jobs() ([]api.JobStatus, error) {
+	js.m.Lock()
+	jobs := maps.Clone(js.jobs)
+	js.m.Unlock()
+
+	statuses := make([]api.JobStatus, 0, len(jobs))
+	for id, job := range jobs {
+		w, h, err := job.FullImageDimensions()
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", id, err)
+		}
+		progress, err := job.Progress()
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", id, err)
+		}
+		status := api.JobStatus{ID: id, Width: w, Height: h, Progress: progress}
+		if job, ok := job.(interface{ Stats() scheduler.RenderStats }); ok {
+			stats := job.Stats()
+			status.Renders, status.Wasted, status.Cancelled = stats.Renders, stats.Wasted, stats.Cancelled
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b api.JobStatus) int { return int(a.ID - b.ID) })
+	return statuses, nil
+}
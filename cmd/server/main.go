@@ -2,42 +2,159 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/marben/irpc"
+	"github.com/marben/irpc/irpcgen"
 	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+	"github.com/marben/irpc_dist_mandel/scheduler"
 )
 
 // main is the entry point for the Mandelbrot server.
 // Note: All rendering is performed by clients (web and CLI); the server only coordinates and distributes work.
 func main() {
-	if err := run(); err != nil {
+	// configuration comes from flags, MANDEL_* environment variables and optional json file (see config.go)
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("loadConfig: %v", err)
+	}
+
+	if err := run(cfg); err != nil {
 		log.Fatalf("run: %+v", err)
 	}
 }
 
-func run() error {
-	// replace SeahorseValley with other predefined region to see other parts of mb set
-	imgWorkScheduler := newImgWorkScheduler(1920, 1080, SeahorseValley)
+func run(cfg config) error {
+	// interrupt (ctrl+c) or SIGTERM shuts the server down gracefully
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// .map and .ugr palette files in palettes directory are added to built-in palettes
+	if err := loadPalettes(cfg.PalettesDir); err != nil {
+		return fmt.Errorf("loadPalettes: %w", err)
+	}
+
+	// replace DefaultRenderParams with params from traps.go to try other orbit traps
+	params := api.DefaultRenderParams
+	// see log output for available palettes
+	// palette is sent to workers as part of params, so they don't need the palette files
+	palette, found := render.LookupPalette(cfg.Palette)
+	if !found {
+		return fmt.Errorf("invalid config: -palette %q is unknown, available palettes: %s", cfg.Palette, strings.Join(render.PaletteNames(), ", "))
+	}
+	params.Palette = palette
+
+	// rendered tiles are cached on disk (up to 1 GB by default), so rendering the same job again is free
+	var cache *scheduler.TileCache
+	if cfg.TileCacheSize > 0 {
+		var err error
+		cache, err = scheduler.OpenTileCache(cfg.TileCacheDir, cfg.TileCacheSize)
+		if err != nil {
+			return fmt.Errorf("scheduler.OpenTileCache: %w", err)
+		}
+	}
+
+	// a sample of workers' tiles is rendered again by the server to catch malicious or broken workers, if -verify-rate is set
+	var verification *scheduler.Verification
+	if cfg.VerifyRate > 0 {
+		verification = &scheduler.Verification{
+			Rate:           cfg.VerifyRate,
+			Tolerance:      cfg.VerifyTolerance,
+			MaxBadFraction: cfg.VerifyMaxBadFraction,
+			Reference:      render.RendererImpl{NoSleep: true}, // the slowdown would only hold the worker's tile
+		}
+	}
+	// workers caught returning bad tiles get no more work for an hour by default
+	quarantined := newQuarantine(cfg.QuarantineTime)
+
+	// pool shares all connected workers among the map tiles and the job
+	pool := scheduler.NewWorkPool(verification)
+	if cache != nil {
+		// tiles of rejected workers are removed from the cache, even of jobs that are finished already
+		pool.AddRejecter(cache)
+	}
+
+	// mapTiles renders XYZ tiles for the map viewer on demand, keeping up to 4096 tiles in memory by default.
+	// it is added first, so that map tiles take priority over the job
+	tiles := newMapTiles(pool, params, cfg.MapTilesCacheSize, cfg.MapTileTimeout)
+	pool.AddSource(tiles)
+
+	// the default job is given by -job. Unfinished image job checkpointed in checkpoint directory is resumed after restart
+	job, imgJob, err := newDefaultJob(cfg, params, cache)
+	if err != nil {
+		return fmt.Errorf("newDefaultJob: %w", err)
+	}
+	// finished image is saved to -output, if it is set
+	outputSaved := make(chan struct{})
+	go func() {
+		saveOutput(cfg, job, imgJob)
+		close(outputSaved)
+	}()
+
+	// progress is saved every 30 seconds by default and once more on shutdown, the checkpoint is removed once the image is finished
+	checkpointCtx, stopCheckpoints := context.WithCancel(context.Background())
+	defer stopCheckpoints()
+	checkpointed := make(chan struct{})
+	if imgJob != nil && cfg.CheckpointDir != "" {
+		go func() {
+			imgJob.CheckpointLoop(checkpointCtx, cfg.CheckpointDir, cfg.CheckpointInterval)
+			close(checkpointed)
+		}()
+	} else {
+		close(checkpointed)
+	}
+	pool.AddSource(job)
 
 	// imgProviderIrpcService provides api.ImgProvider interface over network
-	// It defines only one function GetImage(), which returns the full image upon complete render
-	// It is used by our cli clients.
-	// ImgProvider is implemented by imgWorkScheduler, so we use our one instance to back the service
-	imgProviderIrpcService := api.NewImgProviderIrpcService(imgWorkScheduler)
+	// It lets cli clients submit their own jobs and receive images of any job as they are rendered.
+	// Our job is registered as api.ServerJobID, submitted jobs are rendered by the same pool
+	imgProvider := newJobRegistry(pool, cache, job, cfg)
 
 	// tileProviderIrpcService provides api.TileProvider interface over network
 	// It provides many different functions to provide web clients a view of progressive rendering, workers number etc
-	// TileProvider is also iplemented by imgWorkScheduler, so we use the same instance as with imgProvderIrpcSevice
-	// to share computational power among both cli and web clients
-	tileProviderIrpcService := api.NewTileProviderIrpcService(imgWorkScheduler)
+	// TileProvider is also iplemented by the job, so we use the same instance as with imgProvderIrpcSevice
+	// to share computational power among both cli and web clients. Workers count comes from the pool
+	tileProvider := jobTileProvider{renderJob: job, pool: pool}
+
+	// clients authenticate by access tokens of -tokens-file, their roles decide what they may call
+	tokens, err := loadTokenStore(cfg.TokensFile)
+	if err != nil {
+		return fmt.Errorf("loadTokenStore: %w", err)
+	}
+	// each client gets its own irpc services, checking roles of its token
+	services := func(id *identity) []irpcgen.Service {
+		return []irpcgen.Service{
+			api.NewImgProviderIrpcService(authImgProvider{ImgProvider: imgProvider.forClient(id), id: id}),
+			api.NewTileProviderIrpcService(authTileProvider{TileProvider: tileProvider, id: id}),
+		}
+	}
 
 	// irpc server with onConnect hook to plug clients into rendering
-	irpcServer := irpc.NewServer(irpc.WithOnConnect(func(ep *irpc.Endpoint) {
+	irpcServer := newRPCServer(tokens, services, func(ep *irpc.Endpoint, id *identity) {
 		go func() {
-			log.Printf("got connection from: %s", ep.RemoteAddr())
+			log.Printf("got connection from: %s (%s)", ep.RemoteAddr(), id.name)
+			if !id.has(roleWorker) {
+				return
+			}
+			key := workerKey(ep, id)
+			if quarantined.contains(key) {
+				log.Printf("%s is not a worker: %s is in quarantine", ep.RemoteAddr(), key)
+				return
+			}
 
 			// Each client needs to provide us with api.Renderer so we can use it to render tiles of full image
 			rendererIrpcClient, err := api.NewRendererIrpcClient(ep)
@@ -45,48 +162,140 @@ func run() error {
 				log.Printf("err: new Rendering client: %v", err)
 				return
 			}
+			// clients that only observe (like cli client's status command) fail Ping
+			if err := rendererIrpcClient.Ping(); err != nil {
+				log.Printf("%s is not a worker: %v", ep.RemoteAddr(), err)
+				return
+			}
 
-			// Each connected client is used as a worker
-			if err := imgWorkScheduler.addRenderer(rendererIrpcClient); err != nil {
+			// Each connected client is used as a worker until it disconnects or the server shuts down
+			err = pool.AddRenderer(ep.Context(), rendererIrpcClient)
+			switch {
+			case errors.Is(err, scheduler.ErrBadResult):
+				// the client stays connected, but it isn't given work anymore, even if it reconnects
+				quarantined.add(key)
+				log.Printf("%s: %s quarantined for %s: %v", ep.RemoteAddr(), key, cfg.QuarantineTime, err)
+			case err != nil && !errors.Is(err, scheduler.ErrPoolStopped):
 				log.Printf("err: render on client %q: %v", ep.RemoteAddr(), err)
-				return
 			}
 		}()
-	}))
+	})
 
-	// irpc services need to be registered to server so clients can use them
-	irpcServer.AddService(imgProviderIrpcService, tileProviderIrpcService)
+	// TLS is optional, -tls-cert and -tls-key enable it on both listeners
+	tcpTLS, httpTLS, err := tlsConfigs(cfg)
+	if err != nil {
+		return fmt.Errorf("tlsConfigs: %w", err)
+	}
 
 	// TCP
-	tcpListener, err := net.Listen("tcp", ":8081")
+	tcpListener, err := net.Listen("tcp", cfg.TCPAddr)
 	if err != nil {
 		return fmt.Errorf("net.Listen: %w", err)
 	}
-	log.Println("tcp listening on port: 8081")
+	if tcpTLS != nil {
+		tcpListener = tls.NewListener(tcpListener, tcpTLS)
+		log.Printf("tcp listening on %s with TLS (client certificates required: %t)", cfg.TCPAddr, cfg.TLSClientCA != "")
+	} else {
+		log.Printf("tcp listening on %s", cfg.TCPAddr)
+	}
+
+	// web client files are embedded in the binary, unless -static-dir overrides them
+	static, err := newStaticHandler(cfg.StaticDir)
+	if err != nil {
+		return fmt.Errorf("newStaticHandler: %w", err)
+	}
 
 	// WEBSOCKET
-	websocketListener, httpServer := webServer(context.Background(), 8080)
-	log.Printf("http listening on http://localhost:%d", 8080)
+	websocketListener, httpServer := webServer(context.Background(), cfg, static, tiles, tokens)
+	httpServer.TLSConfig = httpTLS
+	if httpTLS != nil {
+		log.Printf("https listening on %s", cfg.HTTPAddr)
+	} else {
+		log.Printf("http listening on %s", cfg.HTTPAddr)
+	}
+
+	// tokens are reloaded on SIGHUP, clients of revoked and expired tokens are disconnected
+	if tokens != nil {
+		go tokensReloadLoop(ctx, tokens, irpcServer)
+	}
+
+	// failure of any listener shuts the server down
+	serveErr := make(chan error, 3)
 
 	// httpServer provides index.html, main.wasm along with websocket endpoint
 	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
-			log.Fatalf("httpServer: %v", err)
+		listenAndServe := httpServer.ListenAndServe
+		if httpTLS != nil {
+			// certificate is already in httpServer.TLSConfig
+			listenAndServe = func() error { return httpServer.ListenAndServeTLS("", "") }
+		}
+		if err := listenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("httpServer: %w", err)
 		}
 	}()
 
 	// irpcServer can serve multiple multiple listeners. In this case both tcp and websocket
+	// listeners are closed on shutdown, which is not an error
 	go func() {
-		if err := irpcServer.Serve(tcpListener); err != nil {
-			log.Fatalf("server.Serve tcp: %v", err)
+		if err := irpcServer.Serve(tcpListener); !errors.Is(err, net.ErrClosed) && !errors.Is(err, irpc.ErrServerClosed) {
+			serveErr <- fmt.Errorf("server.Serve tcp: %w", err)
 		}
 	}()
 	go func() {
-		if err := irpcServer.Serve(websocketListener); err != nil {
-			log.Fatalf("server.Serve ws: %v", err)
+		if err := irpcServer.Serve(websocketListener); !errors.Is(err, net.ErrClosed) && !errors.Is(err, irpc.ErrServerClosed) {
+			serveErr <- fmt.Errorf("server.Serve ws: %w", err)
 		}
 	}()
 
 	log.Printf("mb server waiting for tcp and websocket connections")
-	select {}
+	select {
+	case <-ctx.Done():
+		log.Printf("shutdown: started, interrupt again to exit immediately")
+	case err = <-serveErr:
+		log.Printf("shutdown: %v", err)
+	}
+	// second signal kills the process
+	stopSignals()
+
+	// Step 1: stop accepting new connections. Connected clients stay connected
+	tcpListener.Close()
+	websocketListener.Close()
+
+	// Step 2: workers get grace period to finish tiles they render, no new tiles are handed out.
+	// http requests in progress get the same grace period
+	graceCtx, cancelGrace := context.WithTimeout(context.Background(), cfg.ShutdownGrace)
+	defer cancelGrace()
+	httpDone := make(chan struct{})
+	go func() {
+		if err := httpServer.Shutdown(graceCtx); err != nil {
+			log.Printf("shutdown: httpServer: %v", err)
+		}
+		close(httpDone)
+	}()
+	if err := pool.Stop(graceCtx); err != nil {
+		log.Printf("shutdown: tiles in progress abandoned: %v", err)
+	}
+	<-httpDone
+
+	// Step 3: save progress of the job, including the tiles finished during the grace period
+	stopCheckpoints()
+	<-checkpointed
+	// disk store is closed, once the finished image is saved
+	if imgJob != nil {
+		select {
+		case <-job.Done():
+			<-outputSaved
+		default:
+		}
+		if err := imgJob.CloseStore(); err != nil {
+			log.Printf("shutdown: close store: %v", err)
+		}
+	}
+
+	// Step 4: close connections of all clients
+	if err := irpcServer.Close(); err != nil {
+		log.Printf("shutdown: irpcServer: %v", err)
+	}
+	log.Printf("shutdown: done")
+	return err
 }
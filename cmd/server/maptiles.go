@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+const (
+	mapTileSize = 256
+	// mapMaxZoom is the deepest zoom level. Deeper tiles run out of float64 precision
+	mapMaxZoom = 40
+)
+
+// mapWorld is the region covered by the single tile of zoom level 0
+var mapWorld = api.MandelRegion{Xmin: -2.5, Xmax: 1.5, Ymin: -2, Ymax: 2}
+
+// mapTileKey identifies XYZ tile
+type mapTileKey struct {
+	z, x, y int
+}
+
+// region returns part of the complex plane covered by the tile
+func (k mapTileKey) region() api.MandelRegion {
+	size := (mapWorld.Xmax - mapWorld.Xmin) / float64(uint64(1)<<k.z)
+	xmin := mapWorld.Xmin + float64(k.x)*size
+	ymin := mapWorld.Ymin + float64(k.y)*size
+	return api.MandelRegion{Xmin: xmin, Xmax: xmin + size, Ymin: ymin, Ymax: ymin + size}
+}
+
+// mapTiles serves XYZ tiles of the mandelbrot plane over http (/tiles/{z}/{x}/{y}.png).
+// Tiles that are not cached are rendered on demand by workers of scheduler.WorkPool.
+// Requests wait for the render up to timeout, then get 503 status with empty body and Retry-After, so that viewers retry.
+// mapTiles implements scheduler.WorkSource
+type mapTiles struct {
+	params  api.RenderParams
+	timeout time.Duration
+	pool    *scheduler.WorkPool
+
+	cache *pngCache
+
+	// pending tiles wait for a worker, inProcess are being rendered
+	pending   map[mapTileKey]*mapTileRender
+	order     []mapTileKey // pending tiles in request order
+	inProcess map[mapTileKey]*mapTileRender
+	m         sync.Mutex
+}
+
+// mapTileRender is a requested tile, pending or in process.
+// Pending tile is dropped once no request waits for it, so that viewers can't queue up work nobody waits for.
+// Once all requests waiting for tile in process are abandoned by viewers (e.g. zooming elsewhere), its render is cancelled.
+type mapTileRender struct {
+	done    chan struct{}      // closed once the tile is rendered
+	waiters int                // requests waiting for the tile
+	cancel  context.CancelFunc // cancels render of tile in process
+}
+
+func newMapTiles(pool *scheduler.WorkPool, params api.RenderParams, cacheSize int, timeout time.Duration) *mapTiles {
+	return &mapTiles{
+		params:    params,
+		timeout:   timeout,
+		pool:      pool,
+		cache:     newPNGCache(cacheSize),
+		pending:   make(map[mapTileKey]*mapTileRender),
+		inProcess: make(map[mapTileKey]*mapTileRender),
+	}
+}
+
+// ServeHTTP implements http.Handler. It expects z, x and y path values, y with .png suffix.
+func (mt *mapTiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, err := parseMapTileKey(r.PathValue("z"), r.PathValue("x"), r.PathValue("y"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, found := mt.cache.get(key)
+	if !found {
+		done, leave := mt.request(key)
+		select {
+		case <-done:
+			data, found = mt.cache.get(key)
+		case <-time.After(mt.timeout):
+		case <-r.Context().Done():
+			leave(true)
+			return
+		}
+		leave(false)
+	}
+
+	if !found {
+		// the tile is still being rendered. viewer should ask again later.
+		// The body is empty, so that image elements fail to load instead of showing it as a tile
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(data)
+}
+
+// parseMapTileKey parses and validates tile coordinates
+func parseMapTileKey(zs, xs, ys string) (mapTileKey, error) {
+	var k mapTileKey
+	var err error
+	if k.z, err = strconv.Atoi(zs); err != nil {
+		return k, fmt.Errorf("z: %w", err)
+	}
+	if k.x, err = strconv.Atoi(xs); err != nil {
+		return k, fmt.Errorf("x: %w", err)
+	}
+	if k.y, err = strconv.Atoi(strings.TrimSuffix(ys, ".png")); err != nil {
+		return k, fmt.Errorf("y: %w", err)
+	}
+	if k.z < 0 || k.z > mapMaxZoom {
+		return k, fmt.Errorf("zoom %d out of range 0..%d", k.z, mapMaxZoom)
+	}
+	if n := 1 << k.z; k.x < 0 || k.y < 0 || k.x >= n || k.y >= n {
+		return k, fmt.Errorf("tile %d/%d out of range at zoom %d", k.x, k.y, k.z)
+	}
+	return k, nil
+}
+
+// request enqueues tile for rendering, unless it is already enqueued
+// returned channel is closed once the tile is rendered
+// leave has to be called once the caller stops waiting. abandoned is true if the viewer doesn't want the tile anymore.
+func (mt *mapTiles) request(key mapTileKey) (done <-chan struct{}, leave func(abandoned bool)) {
+	mt.m.Lock()
+	if _, found := mt.cache.get(key); found {
+		// rendered since the caller looked into the cache
+		mt.m.Unlock()
+		done := make(chan struct{})
+		close(done)
+		return done, func(bool) {}
+	}
+	t, found := mt.inProcess[key]
+	if !found {
+		t, found = mt.pending[key]
+	}
+	if !found {
+		t = &mapTileRender{done: make(chan struct{})}
+		mt.pending[key] = t
+		mt.order = append(mt.order, key)
+	}
+	t.waiters++
+	mt.m.Unlock()
+
+	if !found {
+		mt.pool.Notify()
+	}
+	return t.done, func(abandoned bool) { mt.leave(key, t, abandoned) }
+}
+
+// leave uncounts request waiting for tile t of key.
+// Once the last request leaves, pending tile is dropped. Tile in process is cancelled, if the last request was abandoned.
+// Render of timed out tile goes on, as the viewer asks for it again.
+func (mt *mapTiles) leave(key mapTileKey, t *mapTileRender, abandoned bool) {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+
+	t.waiters--
+	if t.waiters > 0 {
+		return
+	}
+	if mt.pending[key] == t {
+		delete(mt.pending, key)
+		mt.order = slices.DeleteFunc(mt.order, func(k mapTileKey) bool { return k == key })
+	}
+	if mt.inProcess[key] == t && abandoned {
+		// new requests of the tile render it again
+		delete(mt.inProcess, key)
+		t.cancel()
+	}
+}
+
+// PopWork implements scheduler.WorkSource
+// tiles are rendered from the most recently requested, which is what the viewer looks at
+func (mt *mapTiles) PopWork() (scheduler.WorkUnit, bool) {
+	mt.m.Lock()
+	defer mt.m.Unlock()
+
+	if len(mt.order) == 0 {
+		return nil, false
+	}
+	key := mt.order[len(mt.order)-1]
+	mt.order = mt.order[:len(mt.order)-1]
+	t := mt.pending[key]
+	delete(mt.pending, key)
+	renderCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	mt.inProcess[key] = t
+
+	return func(ctx context.Context, renderer api.Renderer) error {
+		defer cancel()
+		stop := context.AfterFunc(ctx, cancel)
+		defer stop()
+
+		tile := image.Rect(0, 0, mapTileSize, mapTileSize)
+		tileImg, err := renderer.RenderTile(renderCtx, key.region(), mt.params, mapTileSize, mapTileSize, tile)
+		if err != nil && !errors.Is(err, scheduler.ErrBadResult) && ctx.Err() == nil && renderCtx.Err() != nil {
+			// abandoned by all viewers, not a failure of the renderer
+			return nil
+		}
+		if err != nil {
+			mt.requeue(key, t)
+			return fmt.Errorf("render of map tile %v failed: %w", key, err)
+		}
+
+		data, err := encodePNG8(tileImg)
+		if err != nil {
+			// broken tile from a worker, so we don't keep the worker
+			mt.requeue(key, t)
+			return fmt.Errorf("encode map tile %v: %w", key, err)
+		}
+		mt.cache.put(key, data, scheduler.WorkerID(renderer))
+
+		mt.m.Lock()
+		if mt.inProcess[key] == t {
+			delete(mt.inProcess, key)
+		}
+		mt.m.Unlock()
+		close(t.done)
+		return nil
+	}, true
+}
+
+// RejectWorker implements scheduler.WorkerRejecter
+// Tiles rendered by worker id are dropped from the cache, so that viewers get them rendered again.
+func (mt *mapTiles) RejectWorker(id uint64) {
+	if id == 0 {
+		return
+	}
+	if removed := mt.cache.removeWorker(id); removed > 0 {
+		log.Printf("map tiles: %d tiles of rejected worker removed", removed)
+	}
+}
+
+// requeue returns tile t that failed to render back to pending tiles, unless it was abandoned meanwhile
+func (mt *mapTiles) requeue(key mapTileKey, t *mapTileRender) {
+	mt.m.Lock()
+	if mt.inProcess[key] != t {
+		mt.m.Unlock()
+		return
+	}
+	mt.pending[key] = t
+	delete(mt.inProcess, key)
+	mt.order = append(mt.order, key)
+	mt.m.Unlock()
+
+	mt.pool.Notify()
+}
+
+// encodePNG8 encodes img as 8 bits per channel png, which is plenty for viewing and half the size
+func encodePNG8(img image.Image) ([]byte, error) {
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pngCache is LRU cache of encoded tiles
+type pngCache struct {
+	maxEntries int
+	entries    map[mapTileKey]*list.Element
+	lru        *list.List // front is the most recently used
+	m          sync.Mutex
+}
+
+type pngCacheEntry struct {
+	key    mapTileKey
+	data   []byte
+	worker uint64 // see scheduler.WorkerID
+}
+
+func newPNGCache(maxEntries int) *pngCache {
+	return &pngCache{
+		maxEntries: maxEntries,
+		entries:    make(map[mapTileKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *pngCache) get(key mapTileKey) ([]byte, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*pngCacheEntry).data, true
+}
+
+func (c *pngCache) put(key mapTileKey, data []byte, worker uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if e, found := c.entries[key]; found {
+		e.Value.(*pngCacheEntry).data = data
+		e.Value.(*pngCacheEntry).worker = worker
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&pngCacheEntry{key: key, data: data, worker: worker})
+
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*pngCacheEntry).key)
+	}
+}
+
+// removeWorker removes tiles rendered by worker and returns their count
+func (c *pngCache) removeWorker(worker uint64) int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	removed := 0
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*pngCacheEntry); entry.worker == worker {
+			c.lru.Remove(e)
+			delete(c.entries, entry.key)
+			removed++
+		}
+		e = next
+	}
+	return removed
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/marben/irpc_dist_mandel/render"
+)
+
+// loadPalettes registers all .map and .ugr palettes found in dir
+// missing dir is not an error
+func loadPalettes(dir string) error {
+	defer func() { log.Printf("palettes: %s", strings.Join(render.PaletteNames(), ", ")) }()
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".map" && ext != ".ugr") {
+			continue
+		}
+		palettes, err := render.LoadPaletteFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("render.LoadPaletteFile: %w", err)
+		}
+		for _, p := range palettes {
+			render.RegisterPalette(p)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+const (
+	pyramidTileSize = 256
+	// pyramidPreviewSize limits the level shown to web clients and returned by GetImage
+	pyramidPreviewSize = 2048
+)
+
+var _ renderJob = &pyramidJob{}
+
+// pyramidTile identifies tile of a Deep Zoom pyramid level
+type pyramidTile struct {
+	level, col, row int
+}
+
+// pyramidRenders tracks copies of a tile being rendered
+type pyramidRenders struct {
+	ctx    context.Context // cancelled once a copy is written
+	cancel context.CancelFunc
+	copies int
+}
+
+// pyramidJob renders w×h image as Deep Zoom (DZI) tile pyramid in outDir, without holding the image in memory.
+// Workers render tiles of the full resolution level, lower levels are downsampled from finished tiles on disk
+// as soon as all their children are written.
+// Web clients and GetImage see the largest level that fits into pyramidPreviewSize.
+// pyramidJob provides its image for api.ImgProvider and implements most of api.TileProvider
+type pyramidJob struct {
+	w, h     int
+	region   api.MandelRegion
+	params   api.RenderParams
+	outDir   string
+	maxLevel int // full resolution level
+	preview  int // level shown to web clients
+
+	maxCopies int // workers rendering the same tile at once, see scheduler.DefaultMaxTileCopies
+
+	unstarted  map[pyramidTile]struct{} // full resolution tiles
+	inProcess  map[pyramidTile]struct{}
+	renders    map[pyramidTile]*pyramidRenders // renders of tiles in process
+	written    map[pyramidTile]struct{}        // tiles of all levels written to disk
+	renderedBy map[pyramidTile]uint64          // worker of written full resolution tile, see scheduler.WorkerID
+	remaining  int                             // tiles of all levels not written yet
+	rendered   int                             // full resolution tiles written
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	m         sync.Mutex
+
+	// preview level assembled for GetImage
+	previewOnce sync.Once
+	previewImg  *image.RGBA64
+	previewErr  error
+}
+
+// newPyramidJob creates job rendering w×h image of region into outDir/image.dzi and outDir/image_files.
+// Up to maxCopies workers render the same tile at once, once no tile is left unstarted.
+func newPyramidJob(w, h int, region api.MandelRegion, params api.RenderParams, outDir string, maxCopies int) *pyramidJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	pj := &pyramidJob{
+		w:          w,
+		h:          h,
+		region:     region,
+		params:     params,
+		outDir:     outDir,
+		maxCopies:  max(maxCopies, 1),
+		unstarted:  make(map[pyramidTile]struct{}),
+		inProcess:  make(map[pyramidTile]struct{}),
+		renders:    make(map[pyramidTile]*pyramidRenders),
+		written:    make(map[pyramidTile]struct{}),
+		renderedBy: make(map[pyramidTile]uint64),
+		ctx:        ctx,
+		ctxCancel:  cancel,
+	}
+
+	// the deepest level is the first with 1×1 size at level 0
+	for max(w, h) > 1<<pj.maxLevel {
+		pj.maxLevel++
+	}
+	for l := 0; l <= pj.maxLevel; l++ {
+		lw, lh := pj.levelSize(l)
+		if lw <= pyramidPreviewSize && lh <= pyramidPreviewSize {
+			pj.preview = l
+		}
+		cols, rows := pj.levelTiles(l)
+		pj.remaining += cols * rows
+	}
+	cols, rows := pj.levelTiles(pj.maxLevel)
+	for row := range rows {
+		for col := range cols {
+			pj.unstarted[pyramidTile{pj.maxLevel, col, row}] = struct{}{}
+		}
+	}
+
+	if err := pj.writeDescriptor(); err != nil {
+		log.Printf("pyramid: %v", err)
+	}
+	log.Printf("pyramid: %dx%d image, %d levels, %d tiles to render", w, h, pj.maxLevel+1, len(pj.unstarted))
+
+	return pj
+}
+
+// levelSize returns dimensions of level l. Each level is half the size of the next one, rounded up.
+func (pj *pyramidJob) levelSize(l int) (w, h int) {
+	shift := pj.maxLevel - l
+	return (pj.w + 1<<shift - 1) >> shift, (pj.h + 1<<shift - 1) >> shift
+}
+
+// levelTiles returns number of tile columns and rows of level l
+func (pj *pyramidJob) levelTiles(l int) (cols, rows int) {
+	w, h := pj.levelSize(l)
+	return (w + pyramidTileSize - 1) / pyramidTileSize, (h + pyramidTileSize - 1) / pyramidTileSize
+}
+
+// tileRect returns rectangle of tile t in coordinates of its level
+func (pj *pyramidJob) tileRect(t pyramidTile) image.Rectangle {
+	w, h := pj.levelSize(t.level)
+	r := image.Rect(t.col*pyramidTileSize, t.row*pyramidTileSize, (t.col+1)*pyramidTileSize, (t.row+1)*pyramidTileSize)
+	return r.Intersect(image.Rect(0, 0, w, h))
+}
+
+// tilePath returns file of tile t, as laid out by the Deep Zoom format
+func (pj *pyramidJob) tilePath(t pyramidTile) string {
+	return filepath.Join(pj.outDir, "image_files", fmt.Sprint(t.level), fmt.Sprintf("%d_%d.png", t.col, t.row))
+}
+
+// writeDescriptor writes image.dzi, which viewers open to find the tiles
+func (pj *pyramidJob) writeDescriptor() error {
+	if err := os.MkdirAll(pj.outDir, 0o755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	dzi := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="png" Overlap="0" TileSize="%d">
+	<Size Width="%d" Height="%d"/>
+</Image>
+`, pyramidTileSize, pj.w, pj.h)
+	if err := os.WriteFile(filepath.Join(pj.outDir, "image.dzi"), []byte(dzi), 0o644); err != nil {
+		return fmt.Errorf("os.WriteFile: %w", err)
+	}
+	return nil
+}
+
+// PopWork implements scheduler.WorkSource
+// unit of work is rendering of a single full resolution tile
+func (pj *pyramidJob) PopWork() (scheduler.WorkUnit, bool) {
+	t, r, found := pj.popTile()
+	if !found {
+		return nil, false
+	}
+	return func(ctx context.Context, renderer api.Renderer) error {
+		failed := false
+		defer func() { pj.endRender(t, r, failed) }()
+
+		// the copy is cancelled once another copy of the tile is written
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(r.ctx, cancel)
+		defer stop()
+
+		tileImg, err := renderer.RenderTile(ctx, pj.region, pj.params, pj.w, pj.h, pj.tileRect(t))
+		if err != nil && !errors.Is(err, scheduler.ErrBadResult) && r.ctx.Err() != nil {
+			// another worker was faster. Not a failure of the renderer
+			return nil
+		}
+		if err != nil {
+			failed = true
+			return fmt.Errorf("render of pyramid tile %d_%d failed: %w", t.col, t.row, err)
+		}
+		pj.finishTile(t, tileImg, scheduler.WorkerID(renderer))
+		return nil
+	}, true
+}
+
+// popTile returns unstarted full resolution tile and its renders, which count the returned copy.
+// If there is no unstarted tile, the tile in process with the fewest copies is handed out again,
+// unless all tiles in process are rendered by maxCopies workers already.
+func (pj *pyramidJob) popTile() (t pyramidTile, r *pyramidRenders, found bool) {
+	pj.m.Lock()
+	defer pj.m.Unlock()
+
+	for t = range pj.unstarted {
+		delete(pj.unstarted, t)
+		pj.inProcess[t] = struct{}{}
+		return t, pj.addCopy(t), true
+	}
+	copies := pj.maxCopies
+	for tile := range pj.inProcess {
+		n := 0
+		if r := pj.renders[tile]; r != nil {
+			n = r.copies
+		}
+		if n < copies {
+			t, copies, found = tile, n, true
+		}
+	}
+	if !found {
+		return pyramidTile{}, nil, false
+	}
+	return t, pj.addCopy(t), true
+}
+
+// addCopy counts a new copy of tile t being rendered and returns its renders
+// pj.m must be held
+func (pj *pyramidJob) addCopy(t pyramidTile) *pyramidRenders {
+	r := pj.renders[t]
+	if r == nil {
+		ctx, cancel := context.WithCancel(pj.ctx)
+		r = &pyramidRenders{ctx: ctx, cancel: cancel}
+		pj.renders[t] = r
+	}
+	r.copies++
+	return r
+}
+
+// endRender uncounts a finished copy r of tile t.
+// If the last copy failed, the tile is returned to unstarted tiles, so that it is handed out before the tiles in process.
+func (pj *pyramidJob) endRender(t pyramidTile, r *pyramidRenders, failed bool) {
+	pj.m.Lock()
+	defer pj.m.Unlock()
+
+	r.copies--
+	if r.copies > 0 || pj.renders[t] != r {
+		// other copies are still rendered, or the tile was written
+		return
+	}
+	r.cancel()
+	delete(pj.renders, t)
+	if _, found := pj.inProcess[t]; found && failed {
+		delete(pj.inProcess, t)
+		pj.unstarted[t] = struct{}{}
+	}
+}
+
+// finishTile writes full resolution tile rendered by worker and builds all lower level tiles it completes
+func (pj *pyramidJob) finishTile(t pyramidTile, img image.Image, worker uint64) {
+	pj.m.Lock()
+	_, found := pj.inProcess[t]
+	delete(pj.inProcess, t)
+	if found && worker != 0 {
+		pj.renderedBy[t] = worker
+	}
+	if r := pj.renders[t]; found && r != nil {
+		// cancels the other copies. Copies of the tile handed out again (see RejectWorker) get new context
+		r.cancel()
+		delete(pj.renders, t)
+	}
+	pj.m.Unlock()
+	if !found {
+		// rendered by another worker in the meantime
+		return
+	}
+
+	for {
+		// failure to save is only logged, so that the pyramid still finishes
+		if err := savePNG(pj.tilePath(t), toRGBA(img)); err != nil {
+			log.Printf("pyramid: save tile %v: %v", t, err)
+		}
+
+		parent, complete := pj.markDone(t)
+		if !complete {
+			return
+		}
+		img = pj.buildTile(parent)
+		t = parent
+	}
+}
+
+// markDone marks tile t as written
+// returns t's parent if t was its last unfinished child
+func (pj *pyramidJob) markDone(t pyramidTile) (parent pyramidTile, complete bool) {
+	pj.m.Lock()
+	defer pj.m.Unlock()
+
+	// tile may be written again, if it was built from a rejected tile (see RejectWorker)
+	if _, found := pj.written[t]; !found {
+		pj.written[t] = struct{}{}
+		pj.remaining--
+		if t.level == pj.maxLevel {
+			pj.rendered++
+			cols, rows := pj.levelTiles(pj.maxLevel)
+			log.Printf("pyramid: rendered: %.2f%%", float32(pj.rendered)/float32(cols*rows)*100)
+		}
+	}
+	if pj.remaining == 0 {
+		log.Printf("pyramid: finished in %q", pj.outDir)
+		pj.ctxCancel()
+	}
+	if t.level == 0 {
+		return pyramidTile{}, false
+	}
+
+	parent = pyramidTile{t.level - 1, t.col / 2, t.row / 2}
+	for _, child := range pj.children(parent) {
+		if _, found := pj.written[child]; !found {
+			return pyramidTile{}, false
+		}
+	}
+	return parent, true
+}
+
+// RejectWorker implements scheduler.WorkerRejecter
+// Full resolution tiles rendered by worker id are rendered again, and lower level tiles built from them are built again.
+// Finished pyramid is kept as it is.
+func (pj *pyramidJob) RejectWorker(id uint64) {
+	if id == 0 {
+		return
+	}
+	pj.m.Lock()
+	defer pj.m.Unlock()
+	if pj.ctx.Err() != nil {
+		return
+	}
+
+	rejected := 0
+	for t, by := range pj.renderedBy {
+		if by != id {
+			continue
+		}
+		delete(pj.renderedBy, t)
+		pj.unstarted[t] = struct{}{}
+		pj.rendered--
+		rejected++
+		// the tile and its ancestors are not written until the tile is rendered again
+		for {
+			if _, found := pj.written[t]; !found {
+				break
+			}
+			delete(pj.written, t)
+			pj.remaining++
+			if t.level == 0 {
+				break
+			}
+			t = pyramidTile{t.level - 1, t.col / 2, t.row / 2}
+		}
+	}
+	if rejected > 0 {
+		log.Printf("pyramid: %d tiles of rejected worker are rendered again", rejected)
+	}
+}
+
+// children returns tiles of the next level covered by tile t
+func (pj *pyramidJob) children(t pyramidTile) []pyramidTile {
+	cols, rows := pj.levelTiles(t.level + 1)
+	var children []pyramidTile
+	for row := 2 * t.row; row < min(2*t.row+2, rows); row++ {
+		for col := 2 * t.col; col < min(2*t.col+2, cols); col++ {
+			children = append(children, pyramidTile{t.level + 1, col, row})
+		}
+	}
+	return children
+}
+
+// buildTile downsamples children of tile t from disk
+func (pj *pyramidJob) buildTile(t pyramidTile) *image.RGBA {
+	rect := pj.tileRect(t)
+	img := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+
+	for _, child := range pj.children(t) {
+		childImg, err := loadPNG(pj.tilePath(child))
+		if err != nil {
+			log.Printf("pyramid: load tile %v: %v", child, err)
+			continue
+		}
+		offset := image.Pt((child.col-2*t.col)*pyramidTileSize/2, (child.row-2*t.row)*pyramidTileSize/2)
+		downsample(img, offset, toRGBA(childImg))
+	}
+	return img
+}
+
+// downsample draws src at half size onto dst at offset, averaging 2×2 blocks of pixels
+// blocks at odd right and bottom edges are averaged from the pixels available
+func downsample(dst *image.RGBA, offset image.Point, src *image.RGBA) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < (sh+1)/2; y++ {
+		for x := 0; x < (sw+1)/2; x++ {
+			var sum [4]int
+			n := 0
+			for sy := 2 * y; sy < min(2*y+2, sh); sy++ {
+				for sx := 2 * x; sx < min(2*x+2, sw); sx++ {
+					i := src.PixOffset(src.Rect.Min.X+sx, src.Rect.Min.Y+sy)
+					for c := range sum {
+						sum[c] += int(src.Pix[i+c])
+					}
+					n++
+				}
+			}
+			i := dst.PixOffset(offset.X+x, offset.Y+y)
+			for c := range sum {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+}
+
+// toRGBA returns img as 8 bits per channel image with the same bounds
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// loadPNG decodes png file
+func loadPNG(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("png.Decode: %w", err)
+	}
+	return img, nil
+}
+
+// previewTile returns tile of the preview level at rect
+func (pj *pyramidJob) previewTile(rect image.Rectangle) pyramidTile {
+	return pyramidTile{pj.preview, rect.Min.X / pyramidTileSize, rect.Min.Y / pyramidTileSize}
+}
+
+// FinishedTiles implements api.TileProvider
+// returns finished tiles of the preview level
+func (pj *pyramidJob) FinishedTiles() (map[image.Rectangle]struct{}, error) {
+	pj.m.Lock()
+	defer pj.m.Unlock()
+
+	finished := make(map[image.Rectangle]struct{})
+	for t := range pj.written {
+		if t.level == pj.preview {
+			finished[pj.tileRect(t)] = struct{}{}
+		}
+	}
+	return finished, nil
+}
+
+// GetTileImg implements api.TileProvider
+// returns tile of the preview level. Unfinished tiles are transparent.
+func (pj *pyramidJob) GetTileImg(rect image.Rectangle) (*image.RGBA, error) {
+	tileImg := image.NewRGBA(rect)
+
+	t := pj.previewTile(rect)
+	pj.m.Lock()
+	_, done := pj.written[t]
+	pj.m.Unlock()
+	if !done {
+		return tileImg, nil
+	}
+
+	img, err := loadPNG(pj.tilePath(t))
+	if err != nil {
+		return nil, fmt.Errorf("load tile %v: %w", t, err)
+	}
+	tileRect := pj.tileRect(t)
+	draw.Draw(tileImg, rect, img, rect.Min.Sub(tileRect.Min), draw.Src)
+	return tileImg, nil
+}
+
+// FullImageDimensions implements api.TileProvider
+// returns dimensions of the preview level
+func (pj *pyramidJob) FullImageDimensions() (width, height int, err error) {
+	width, height = pj.levelSize(pj.preview)
+	return width, height, nil
+}
+
+// TotalTilesCount implements api.TileProvider
+// returns tiles count of the preview level
+func (pj *pyramidJob) TotalTilesCount() (int, error) {
+	cols, rows := pj.levelTiles(pj.preview)
+	return cols * rows, nil
+}
+
+// Frames implements api.TileProvider
+func (pj *pyramidJob) Frames() (current, total int, err error) {
+	return 0, 1, nil
+}
+
+// GetImage implements renderJob
+// blocks until the pyramid is finished and returns its preview level
+// (the full resolution image is only available as pyramid on disk)
+func (pj *pyramidJob) GetImage() (*image.RGBA64, error) {
+	<-pj.ctx.Done()
+
+	pj.previewOnce.Do(func() {
+		pj.previewImg, pj.previewErr = pj.assemblePreview()
+	})
+	return pj.previewImg, pj.previewErr
+}
+
+// Progress implements renderJob
+// progress is the finished fraction of full resolution tiles
+func (pj *pyramidJob) Progress() (float64, error) {
+	pj.m.Lock()
+	defer pj.m.Unlock()
+
+	cols, rows := pj.levelTiles(pj.maxLevel)
+	return float64(pj.rendered) / float64(cols*rows), nil
+}
+
+// GetImageRows implements renderJob
+// returns rows of the preview level, once the pyramid is finished
+func (pj *pyramidJob) GetImageRows(ctx context.Context, y, n int) (*image.RGBA64, error) {
+	return finalImageRows(ctx, pj, y, n)
+}
+
+// Done implements renderJob
+func (pj *pyramidJob) Done() <-chan struct{} {
+	return pj.ctx.Done()
+}
+
+// assemblePreview loads all tiles of the preview level into a single image
+func (pj *pyramidJob) assemblePreview() (*image.RGBA64, error) {
+	w, h := pj.levelSize(pj.preview)
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	cols, rows := pj.levelTiles(pj.preview)
+	for row := range rows {
+		for col := range cols {
+			t := pyramidTile{pj.preview, col, row}
+			tileImg, err := loadPNG(pj.tilePath(t))
+			if err != nil {
+				return nil, fmt.Errorf("load tile %v: %w", t, err)
+			}
+			draw.Draw(img, pj.tileRect(t), tileImg, image.Point{}, draw.Src)
+		}
+	}
+	return img, nil
+}
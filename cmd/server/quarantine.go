@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marben/irpc"
+)
+
+// quarantine holds workers caught returning bad tiles (see scheduler.ErrBadResult).
+// Quarantined workers may stay connected, but they are not given any work until the quarantine expires.
+type quarantine struct {
+	duration time.Duration
+	until    map[string]time.Time // by workerKey
+	m        sync.Mutex
+}
+
+func newQuarantine(duration time.Duration) *quarantine {
+	return &quarantine{duration: duration, until: make(map[string]time.Time)}
+}
+
+// connections numbers connections of anonymous workers for workerKey
+var connections atomic.Uint64
+
+// workerKey identifies worker: by its token across connections, or by the connection if authentication is disabled.
+// IP addresses are not used, as workers behind the same address would share the quarantine of a single bad one.
+// Anonymous workers caught returning bad tiles may therefore get work again after reconnecting.
+func workerKey(ep *irpc.Endpoint, id *identity) string {
+	if id != anonymous {
+		return "token " + id.name
+	}
+	return fmt.Sprintf("connection %d from %s", connections.Add(1), ep.RemoteAddr())
+}
+
+// add quarantines worker key. Expired quarantines are dropped, so that keys of workers that never return don't pile up
+func (q *quarantine) add(key string) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	now := time.Now()
+	for k, until := range q.until {
+		if now.After(until) {
+			delete(q.until, k)
+		}
+	}
+	q.until[key] = now.Add(q.duration)
+}
+
+// contains returns true if worker key is in quarantine
+func (q *quarantine) contains(key string) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	until, found := q.until[key]
+	if found && time.Now().After(until) {
+		delete(q.until, key)
+		return false
+	}
+	return found
+}
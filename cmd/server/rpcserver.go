@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/marben/irpc"
+	"github.com/marben/irpc/irpcgen"
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// handshakeTimeout limits how long a tcp client may take to authenticate (including TLS handshake)
+const handshakeTimeout = 10 * time.Second
+
+// authConn is a connection authenticated before it was accepted, like websocket connections authenticated by http request
+type authConn struct {
+	net.Conn
+	id *identity
+}
+
+// rpcServer serves irpc endpoints of authenticated clients on any number of listeners.
+// Unlike irpc.Server, services of each endpoint are given by the client's identity, so that they can check its roles.
+// Connections are authenticated by handshake (see api.ClientHandshake), unless they are authConn.
+type rpcServer struct {
+	tokens    *tokenStore
+	services  func(id *identity) []irpcgen.Service
+	onConnect func(ep *irpc.Endpoint, id *identity) // called synchronously for each authenticated client
+
+	listeners map[net.Listener]struct{}
+	pending   map[net.Conn]struct{} // connections in handshake
+	endpoints map[*irpc.Endpoint]*identity
+	closed    bool
+	wg        sync.WaitGroup
+	m         sync.Mutex
+}
+
+func newRPCServer(tokens *tokenStore, services func(id *identity) []irpcgen.Service, onConnect func(ep *irpc.Endpoint, id *identity)) *rpcServer {
+	return &rpcServer{
+		tokens:    tokens,
+		services:  services,
+		onConnect: onConnect,
+		listeners: make(map[net.Listener]struct{}),
+		pending:   make(map[net.Conn]struct{}),
+		endpoints: make(map[*irpc.Endpoint]*identity),
+	}
+}
+
+// Serve accepts connections of lis until lis or the server is closed.
+// It returns irpc.ErrServerClosed after Close.
+func (s *rpcServer) Serve(lis net.Listener) error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return irpc.ErrServerClosed
+	}
+	s.listeners[lis] = struct{}{}
+	s.m.Unlock()
+	defer func() {
+		s.m.Lock()
+		delete(s.listeners, lis)
+		s.m.Unlock()
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return irpc.ErrServerClosed
+			}
+			return fmt.Errorf("lis.Accept: %w", err)
+		}
+
+		s.m.Lock()
+		if s.closed {
+			s.m.Unlock()
+			conn.Close()
+			return irpc.ErrServerClosed
+		}
+		s.pending[conn] = struct{}{}
+		s.wg.Add(1)
+		s.m.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn authenticates conn and serves its endpoint until it is closed
+func (s *rpcServer) serveConn(conn net.Conn) {
+	id, err := s.authenticate(conn)
+
+	s.m.Lock()
+	delete(s.pending, conn)
+	if err == nil && s.closed {
+		err = irpc.ErrServerClosed
+	}
+	if err != nil {
+		s.m.Unlock()
+		log.Printf("%s rejected: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	ep := irpc.NewEndpoint(conn,
+		irpc.WithEndpointServices(s.services(id)...),
+		irpc.WithLocalAddress(conn.LocalAddr()),
+		irpc.WithRemoteAddress(conn.RemoteAddr()),
+	)
+	s.endpoints[ep] = id
+	s.m.Unlock()
+
+	s.onConnect(ep, id)
+	<-ep.Context().Done()
+
+	s.m.Lock()
+	delete(s.endpoints, ep)
+	s.m.Unlock()
+}
+
+// authenticate returns identity of conn's client
+func (s *rpcServer) authenticate(conn net.Conn) (*identity, error) {
+	if ac, ok := conn.(authConn); ok {
+		return ac.id, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	token, err := api.ReadHandshakeToken(conn)
+	if err != nil {
+		return nil, fmt.Errorf("api.ReadHandshakeToken: %w", err)
+	}
+	id, authErr := s.tokens.authenticate(token)
+	if err := api.WriteHandshakeAnswer(conn, authErr); err != nil {
+		return nil, fmt.Errorf("api.WriteHandshakeAnswer: %w", err)
+	}
+	if authErr != nil {
+		return nil, authErr
+	}
+	conn.SetDeadline(time.Time{})
+	return id, nil
+}
+
+func (s *rpcServer) isClosed() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.closed
+}
+
+// dropRevoked disconnects clients whose tokens were revoked, changed or expired
+func (s *rpcServer) dropRevoked() {
+	s.m.Lock()
+	var revoked []*irpc.Endpoint
+	for ep, id := range s.endpoints {
+		if !s.tokens.valid(id) {
+			log.Printf("%s: token %q is no longer valid, disconnecting", ep.RemoteAddr(), id.name)
+			revoked = append(revoked, ep)
+		}
+	}
+	s.m.Unlock()
+
+	for _, ep := range revoked {
+		ep.Close()
+	}
+}
+
+// Close closes all listeners and connections and waits for them to finish.
+// It returns errors of closing the listeners.
+func (s *rpcServer) Close() error {
+	s.m.Lock()
+	s.closed = true
+	var errs []error
+	for l := range s.listeners {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for conn := range s.pending {
+		conn.Close()
+	}
+	endpoints := make([]*irpc.Endpoint, 0, len(s.endpoints))
+	for ep := range s.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	s.m.Unlock()
+
+	// endpoints are closed without the lock, as their serveConn needs it to finish
+	for _, ep := range endpoints {
+		ep.Close()
+	}
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// embeddedStatic holds web client files, so that the server works from any directory.
+// Rebuild the server after rebuilding main.wasm.
+//
+//go:embed static
+var embeddedStatic embed.FS
+
+// webClientFiles are built by cmd/webclient/build_wasm.sh. They are not tracked by git,
+// so the server builds without them and answers 503 until they are built.
+var webClientFiles = []string{"main.wasm", "wasm_exec.js"}
+
+// contentTypes overrides types of mime.TypeByExtension, which may come from system files
+var contentTypes = map[string]string{
+	".wasm": "application/wasm",
+	".js":   "text/javascript; charset=utf-8",
+	".html": "text/html; charset=utf-8",
+}
+
+// staticFile is a file prepared to be served
+type staticFile struct {
+	data        []byte
+	gzipped     []byte // nil if compression doesn't pay off
+	contentType string
+	etag        string
+	modTime     time.Time
+}
+
+// staticHandler serves web client files, gzipped for clients accepting it.
+// Responses have ETag and must be revalidated (Cache-Control: no-cache),
+// so browsers download files again only when they change.
+type staticHandler struct {
+	fsys  fs.FS
+	files map[string]*staticFile // prepared files of embedded fs. nil if files are read on each request
+}
+
+// newStaticHandler serves files embedded in the binary. If dir is not empty, its files are served instead,
+// read on each request, so that they can be changed during development.
+func newStaticHandler(dir string) (*staticHandler, error) {
+	if dir != "" {
+		log.Printf("static: serving files of %q", dir)
+		return &staticHandler{fsys: os.DirFS(dir)}, nil
+	}
+
+	fsys, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		return nil, fmt.Errorf("fs.Sub: %w", err)
+	}
+	sh := &staticHandler{fsys: fsys, files: make(map[string]*staticFile)}
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := loadStaticFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sh.files[name] = f
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fs.WalkDir: %w", err)
+	}
+	for _, name := range webClientFiles {
+		if sh.files[name] == nil {
+			log.Printf("static: %s is not embedded, the web client is not built: run cmd/webclient/build_wasm.sh and rebuild the server", name)
+		}
+	}
+	return sh, nil
+}
+
+func (sh *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	f, err := sh.file(name)
+	if errors.Is(err, fs.ErrNotExist) && slices.Contains(webClientFiles, name) {
+		http.Error(w, "web client not built: run cmd/webclient/build_wasm.sh and rebuild the server", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("static: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	content, etag := f.data, f.etag
+	h := w.Header()
+	h.Set("Content-Type", f.contentType)
+	h.Set("Cache-Control", "no-cache")
+	if f.gzipped != nil {
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			// gzipped variant is a different representation, so it needs its own etag
+			content, etag = f.gzipped, strings.TrimSuffix(f.etag, `"`)+`-gzip"`
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	h.Set("ETag", etag)
+
+	// ServeContent answers If-None-Match with 304
+	http.ServeContent(w, r, name, f.modTime, bytes.NewReader(content))
+}
+
+// file returns prepared file of given name
+func (sh *staticHandler) file(name string) (*staticFile, error) {
+	if sh.files == nil {
+		return loadStaticFile(sh.fsys, name)
+	}
+	f, found := sh.files[name]
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+// loadStaticFile reads file name of fsys and prepares it to be served
+func loadStaticFile(fsys fs.FS, name string) (*staticFile, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	f := &staticFile{
+		data:        data,
+		contentType: contentType(name),
+		etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modTime:     fi.ModTime(),
+	}
+	if compressible(f.contentType) {
+		gzipped, err := gzipBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("gzip %q: %w", name, err)
+		}
+		if len(gzipped) < len(data) {
+			f.gzipped = gzipped
+		}
+	}
+	return f, nil
+}
+
+// contentType returns Content-Type of file name by its extension
+func contentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ct, found := contentTypes[ext]; found {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// compressible returns true for content types that usually shrink with gzip
+func compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	return strings.HasPrefix(ct, "text/") ||
+		ct == "application/wasm" || ct == "application/json" || ct == "image/svg+xml"
+}
+
+// acceptsGzip returns true if client accepts gzip content encoding
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(enc, "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipBytes returns data compressed by gzip
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
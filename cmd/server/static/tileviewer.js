@@ -0,0 +1,229 @@
+// TileViewer shows image split into a pyramid of tile levels on a canvas, loading only the tiles it shows.
+// It is shared by pyramid.html (Deep Zoom pyramid) and map.html (XYZ tiles), so that the pages need no external libraries.
+//
+// Level maxLevel is the full resolution width×height image, each lower level is half the size of the next one, rounded up.
+// Levels are split into tileSize×tileSize tiles, tileUrl(level, col, row) returns url of a tile.
+// Drag pans the view, wheel and double click zoom.
+//
+// Tiles that are not rendered yet are loaded again later: 503 after Retry-After seconds,
+// 404 after retryMissing milliseconds if it is set (tiles of a pyramid being rendered).
+"use strict";
+
+class TileViewer {
+	constructor(container, opts) {
+		this.width = opts.width;
+		this.height = opts.height;
+		this.tileSize = opts.tileSize;
+		this.maxLevel = opts.maxLevel;
+		this.minLevel = opts.minLevel ?? 0;
+		this.tileUrl = opts.tileUrl;
+		this.retryMissing = opts.retryMissing ?? 0;
+		this.maxPixelRatio = opts.maxPixelRatio ?? 2; // screen pixels per full resolution pixel at the deepest zoom
+		this.maxTiles = opts.maxTiles ?? 1000; // loaded tiles kept in memory
+		this.background = opts.background ?? "#3a3a6e";
+
+		this.canvas = document.createElement("canvas");
+		this.canvas.style.display = "block";
+		this.canvas.style.width = "100%";
+		this.canvas.style.height = "100%";
+		this.canvas.style.touchAction = "none";
+		container.appendChild(this.canvas);
+		this.ctx = this.canvas.getContext("2d");
+
+		// tiles by "level/col/row" key, in order of use. tile is {img, loading, retryAt}
+		this.tiles = new Map();
+
+		this.resize();
+		this.fit();
+		this.listen();
+		new ResizeObserver(() => this.resize()).observe(this.canvas);
+	}
+
+	// fit shows the whole image
+	fit() {
+		this.cx = this.width / 2;
+		this.cy = this.height / 2;
+		this.scale = Math.min(this.viewW / this.width, this.viewH / this.height);
+		this.redraw();
+	}
+
+	// resize matches canvas pixels to its size on screen
+	resize() {
+		const dpr = window.devicePixelRatio || 1;
+		this.dpr = dpr;
+		this.viewW = this.canvas.clientWidth;
+		this.viewH = this.canvas.clientHeight;
+		this.canvas.width = Math.round(this.viewW * dpr);
+		this.canvas.height = Math.round(this.viewH * dpr);
+		this.redraw();
+	}
+
+	// zoomAt multiplies scale by factor, keeping the image point under screen point x, y in place
+	zoomAt(factor, x, y) {
+		const minScale = Math.min(this.viewW / this.width, this.viewH / this.height) / 2;
+		const scale = Math.min(Math.max(this.scale * factor, minScale), this.maxPixelRatio);
+		const px = this.cx + (x - this.viewW / 2) / this.scale;
+		const py = this.cy + (y - this.viewH / 2) / this.scale;
+		this.cx = px - (x - this.viewW / 2) / scale;
+		this.cy = py - (y - this.viewH / 2) / scale;
+		this.scale = scale;
+		this.redraw();
+	}
+
+	listen() {
+		let drag = null;
+		this.canvas.addEventListener("pointerdown", (e) => {
+			drag = { x: e.clientX, y: e.clientY };
+			this.canvas.setPointerCapture(e.pointerId);
+		});
+		this.canvas.addEventListener("pointermove", (e) => {
+			if (!drag) {
+				return;
+			}
+			this.cx -= (e.clientX - drag.x) / this.scale;
+			this.cy -= (e.clientY - drag.y) / this.scale;
+			drag = { x: e.clientX, y: e.clientY };
+			this.redraw();
+		});
+		const stop = () => (drag = null);
+		this.canvas.addEventListener("pointerup", stop);
+		this.canvas.addEventListener("pointercancel", stop);
+		this.canvas.addEventListener("wheel", (e) => {
+			e.preventDefault();
+			const r = this.canvas.getBoundingClientRect();
+			this.zoomAt(Math.pow(2, -e.deltaY / 300), e.clientX - r.left, e.clientY - r.top);
+		}, { passive: false });
+		this.canvas.addEventListener("dblclick", (e) => {
+			const r = this.canvas.getBoundingClientRect();
+			this.zoomAt(e.shiftKey ? 0.5 : 2, e.clientX - r.left, e.clientY - r.top);
+		});
+	}
+
+	// levelScale returns size of level relative to the full resolution level
+	levelScale(level) {
+		return Math.pow(2, level - this.maxLevel);
+	}
+
+	// levelGrid returns count of tile columns and rows of level
+	levelGrid(level) {
+		const s = this.levelScale(level);
+		return {
+			cols: Math.ceil(Math.ceil(this.width * s) / this.tileSize),
+			rows: Math.ceil(Math.ceil(this.height * s) / this.tileSize),
+		};
+	}
+
+	// visibleTiles returns tiles of level in the view
+	visibleTiles(level) {
+		const s = this.levelScale(level);
+		const span = this.tileSize / s; // tile side in full resolution pixels
+		const halfW = this.viewW / 2 / this.scale;
+		const halfH = this.viewH / 2 / this.scale;
+		const grid = this.levelGrid(level);
+		const col0 = Math.max(0, Math.floor((this.cx - halfW) / span));
+		const col1 = Math.min(grid.cols - 1, Math.floor((this.cx + halfW) / span));
+		const row0 = Math.max(0, Math.floor((this.cy - halfH) / span));
+		const row1 = Math.min(grid.rows - 1, Math.floor((this.cy + halfH) / span));
+		const tiles = [];
+		for (let row = row0; row <= row1; row++) {
+			for (let col = col0; col <= col1; col++) {
+				tiles.push({ level, col, row, x: col * span, y: row * span, span });
+			}
+		}
+		return tiles;
+	}
+
+	redraw() {
+		if (this.frame) {
+			return;
+		}
+		this.frame = requestAnimationFrame(() => {
+			this.frame = null;
+			this.draw();
+		});
+	}
+
+	draw() {
+		const ctx = this.ctx;
+		ctx.setTransform(1, 0, 0, 1, 0, 0);
+		ctx.fillStyle = this.background;
+		ctx.fillRect(0, 0, this.canvas.width, this.canvas.height);
+		ctx.imageSmoothingEnabled = true;
+
+		// the level with tiles at least as detailed as the screen. Lower levels are drawn below it while its tiles load
+		const wanted = Math.min(this.maxLevel, Math.max(this.minLevel, this.maxLevel + Math.ceil(Math.log2(this.scale * this.dpr))));
+		for (let level = Math.max(this.minLevel, wanted - 6); level <= wanted; level++) {
+			for (const t of this.visibleTiles(level)) {
+				const tile = level === wanted ? this.load(t) : this.tiles.get(this.key(t));
+				if (!tile || !tile.img) {
+					continue;
+				}
+				const x = ((t.x - this.cx) * this.scale + this.viewW / 2) * this.dpr;
+				const y = ((t.y - this.cy) * this.scale + this.viewH / 2) * this.dpr;
+				// tiles at the right and bottom edges are smaller
+				const w = (tile.img.width / this.tileSize) * t.span * this.scale * this.dpr;
+				const h = (tile.img.height / this.tileSize) * t.span * this.scale * this.dpr;
+				ctx.drawImage(tile.img, x, y, w, h);
+			}
+		}
+	}
+
+	key(t) {
+		return t.level + "/" + t.col + "/" + t.row;
+	}
+
+	// load returns tile t, starting its download if it isn't loaded yet
+	load(t) {
+		const key = this.key(t);
+		let tile = this.tiles.get(key);
+		if (tile) {
+			// keep the most recently used tiles at the end
+			this.tiles.delete(key);
+			this.tiles.set(key, tile);
+		} else {
+			tile = { img: null, loading: false, retryAt: 0 };
+			this.tiles.set(key, tile);
+			this.evict();
+		}
+		if (!tile.img && !tile.loading && Date.now() >= tile.retryAt) {
+			this.download(t, tile);
+		}
+		return tile;
+	}
+
+	async download(t, tile) {
+		tile.loading = true;
+		let retry = 0;
+		try {
+			const resp = await fetch(this.tileUrl(t.level, t.col, t.row));
+			if (resp.ok) {
+				tile.img = await createImageBitmap(await resp.blob());
+			} else if (resp.status === 503) {
+				retry = 1000 * (parseInt(resp.headers.get("Retry-After"), 10) || 1);
+			} else if (resp.status === 404 && this.retryMissing > 0) {
+				retry = this.retryMissing;
+			}
+		} catch (err) {
+			console.log("tile " + this.key(t) + ": " + err);
+			retry = 5000;
+		}
+		tile.loading = false;
+		if (retry > 0) {
+			tile.retryAt = Date.now() + retry;
+			setTimeout(() => this.redraw(), retry);
+		} else if (!tile.img) {
+			tile.retryAt = Infinity; // not a tile of the image
+		}
+		this.redraw();
+	}
+
+	// evict drops the least recently used tiles above maxTiles
+	evict() {
+		for (const key of this.tiles.keys()) {
+			if (this.tiles.size <= this.maxTiles) {
+				break;
+			}
+			this.tiles.delete(key);
+		}
+	}
+}
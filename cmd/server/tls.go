@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsConfigs returns TLS configs of tcp listener and http server, or nils if TLS is not configured.
+// Both use the same certificate. If cfg.TLSClientCA is set, tcp clients (cli workers) must present
+// a certificate signed by it. Web clients are not asked for certificates.
+func tlsConfigs(cfg config) (tcpConf, httpConf *tls.Config, err error) {
+	if cfg.TLSCert == "" {
+		return nil, nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tls.LoadX509KeyPair: %w", err)
+	}
+	httpConf = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	tcpConf = httpConf.Clone()
+	if cfg.TLSClientCA != "" {
+		pool, err := loadCertPool(cfg.TLSClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		tcpConf.ClientAuth = tls.RequireAndVerifyClientCert
+		tcpConf.ClientCAs = pool
+	}
+	return tcpConf, httpConf, nil
+}
+
+// loadCertPool returns pool of PEM encoded certificates in filename
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %q", filename)
+	}
+	return pool, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// Orbit trap render params
+// You can replace api.DefaultRenderParams in main.go with one of these
+var (
+	// Point trap at the origin – glowing dots where orbits pass close to 0
+	PointTrapParams = api.RenderParams{
+		Trap:       api.OrbitTrap{Kind: api.TrapPoint},
+		TrapWeight: 0.4,
+	}
+
+	// Line trap on the real axis – horizontal streaks through the filaments
+	RealAxisTrapParams = api.RenderParams{
+		Trap:       api.OrbitTrap{Kind: api.TrapLine},
+		TrapWeight: 0.3,
+	}
+
+	// Circle trap of radius 0.5 – concentric rings around the bulbs
+	CircleTrapParams = api.RenderParams{
+		Trap:       api.OrbitTrap{Kind: api.TrapCircle, Radius: 0.5},
+		TrapWeight: 0.5,
+	}
+
+	// Cross trap rotated by 45° – diagonal lattice pattern
+	CrossTrapParams = api.RenderParams{
+		Trap:       api.OrbitTrap{Kind: api.TrapCross, Angle: math.Pi / 4},
+		TrapWeight: 0.4,
+	}
+
+	// Pickover stalks – thin stalks sprouting from the set
+	PickoverStalksParams = api.RenderParams{
+		Trap:       api.OrbitTrap{Kind: api.TrapStalks, Radius: 0.05},
+		TrapWeight: 0.6,
+	}
+
+	// No trap – plain smooth iteration coloring
+	NoTrapParams = api.RenderParams{}
+)
@@ -2,25 +2,40 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/coder/websocket"
 )
 
-// WebServer creates server serving files in ./static folder
+// WebServer creates server listening on cfg.HTTPAddr, serving web client files by static, XYZ map tiles on /tiles/{z}/{x}/{y}.png
+// and files of Deep Zoom pyramid directory on /pyramid/
 // initializes websocket endpoint and returns net.Listener accepting websocket connections
-func webServer(ctx context.Context, port int) (net.Listener, *http.Server) {
-	l := NewWSListener(ctx, fmt.Sprintf(":%d/ws", port))
+// Websocket clients, map tiles and pyramid require token of tokens (nil disables authentication), web client files are public.
+// Websocket connections are limited by origin and count as given by cfg.
+func webServer(ctx context.Context, cfg config, static, tiles http.Handler, tokens *tokenStore) (net.Listener, *http.Server) {
+	l := NewWSListener(ctx, cfg.HTTPAddr+"/ws")
+	opts := &websocket.AcceptOptions{OriginPatterns: cfg.origins}
+	if slices.Contains(cfg.origins, "*") {
+		log.Printf("websocket: connections from any origin are allowed")
+		opts = &websocket.AcceptOptions{InsecureSkipVerify: true}
+	}
+	limiter := newConnLimiter(cfg.MaxWSConnections, cfg.MaxWSConnectionsPerIP)
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", websocketHandler(l))
-	mux.Handle("/", http.FileServer(http.Dir("./static")))
+	mux.HandleFunc("/ws", websocketHandler(l, tokens, opts, limiter, cfg.WSPingInterval))
+	mux.Handle("GET /tiles/{z}/{x}/{y}", requireRole(tokens, roleViewer, tiles))
+	mux.Handle("GET /pyramid/", requireRole(tokens, roleViewer, http.StripPrefix("/pyramid/", http.FileServer(http.Dir(cfg.PyramidDir)))))
+	mux.Handle("/", static)
 
 	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", port),
+		Addr:              cfg.HTTPAddr,
 		Handler:           mux,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
@@ -29,46 +44,99 @@ func webServer(ctx context.Context, port int) (net.Listener, *http.Server) {
 }
 
 // websocketHandler handles the http ws endpoint
+// clients are authenticated by token of the request (see requestToken) before the websocket is initialized
+// websocket.Accept rejects origins not allowed by opts. Connections over limits of limiter are closed right away
 // if websocket is succesfully initialized it is passed to WebsocketListener so it can be accepted
-func websocketHandler(l *WebsocketListener) http.HandlerFunc {
+func websocketHandler(l *WebsocketListener, tokens *tokenStore, opts *websocket.AcceptOptions, limiter *connLimiter, pingInterval time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-			OriginPatterns: []string{"*"}, // TODO: tighten in prod
-		})
+		id, err := tokens.authenticate(requestToken(r))
+		if err != nil {
+			log.Printf("%s rejected: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		c, err := websocket.Accept(w, r, opts)
+		if err != nil {
+			log.Printf("%s rejected: %v", r.RemoteAddr, err)
+			return
+		}
+
+		// slot is released once the connection is closed
+		release, err := limiter.acquire(r.RemoteAddr)
 		if err != nil {
-			log.Println(err)
+			log.Printf("%s rejected: %v", r.RemoteAddr, err)
+			c.Close(websocket.StatusTryAgainLater, err.Error())
 			return
 		}
+		conn := &limitedConn{Conn: websocket.NetConn(l.ctx, c, websocket.MessageBinary), release: release}
 
-		l.ch <- c
+		select {
+		case l.ch <- authConn{Conn: conn, id: id}:
+			go keepAlive(l.ctx, c, r.RemoteAddr, pingInterval)
+		case <-l.done:
+			c.Close(websocket.StatusGoingAway, "server is shutting down")
+			release()
+		case <-r.Context().Done():
+			c.CloseNow()
+			release()
+		}
+	}
+}
+
+// keepAlive pings websocket client at addr every interval and disconnects it, if it doesn't answer in time.
+// Closed, crashed or suspended browser tabs are noticed this way, so that the tiles they render are handed out again.
+// It returns once the connection is closed or ctx is done.
+func keepAlive(ctx context.Context, c *websocket.Conn, addr string, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := c.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				log.Printf("%s: no answer to ping in %s, disconnecting", addr, interval)
+			}
+			c.CloseNow()
+			return
+		}
 	}
 }
 
 // WebsocketListener implements net.Listener
 // it's a wrapper around websocket.Conn
+// accepted connections live until they are closed or ctx is done, Close only stops accepting new ones
 type WebsocketListener struct {
-	ch     chan *websocket.Conn
-	done   chan struct{}
-	ctx    context.Context
-	cancel context.CancelFunc
-	addr   wsAddr
+	ch        chan authConn
+	done      chan struct{} // closed by Close
+	closeOnce sync.Once
+	ctx       context.Context
+	addr      wsAddr
 }
 
 func NewWSListener(ctx context.Context, addr string) *WebsocketListener {
-	ctx, cancel := context.WithCancel(ctx)
 	return &WebsocketListener{
-		ch:     make(chan *websocket.Conn),
-		done:   make(chan struct{}),
-		ctx:    ctx,
-		cancel: cancel,
-		addr:   wsAddr{addr: addr},
+		ch:   make(chan authConn),
+		done: make(chan struct{}),
+		ctx:  ctx,
+		addr: wsAddr{addr: addr},
 	}
 }
 
 func (l *WebsocketListener) Accept() (net.Conn, error) {
 	select {
 	case c := <-l.ch:
-		return websocket.NetConn(l.ctx, c, websocket.MessageBinary), nil
+		return c, nil
 	case <-l.ctx.Done():
 		return nil, context.Cause(l.ctx)
 	case <-l.done:
@@ -81,7 +149,7 @@ func (l *WebsocketListener) Addr() net.Addr {
 }
 
 func (l *WebsocketListener) Close() error {
-	l.cancel()
+	l.closeOnce.Do(func() { close(l.done) })
 	return nil
 }
 
@@ -97,3 +165,59 @@ func (a wsAddr) Network() string {
 func (a wsAddr) String() string {
 	return a.addr
 }
+
+// connLimiter limits count of concurrent connections, in total and per client IP address. Zero limit is unlimited.
+type connLimiter struct {
+	max, maxPerIP int
+
+	total int
+	perIP map[string]int
+	m     sync.Mutex
+}
+
+func newConnLimiter(max, maxPerIP int) *connLimiter {
+	return &connLimiter{max: max, maxPerIP: maxPerIP, perIP: make(map[string]int)}
+}
+
+// acquire takes a slot of connection from remoteAddr. release returns the slot and may be called more than once.
+func (cl *connLimiter) acquire(remoteAddr string) (release func(), err error) {
+	// clients behind the same proxy share the limit, forwarding headers are not trusted
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+
+	cl.m.Lock()
+	defer cl.m.Unlock()
+	if cl.max > 0 && cl.total >= cl.max {
+		return nil, fmt.Errorf("too many connections (%d)", cl.total)
+	}
+	if cl.maxPerIP > 0 && cl.perIP[ip] >= cl.maxPerIP {
+		return nil, fmt.Errorf("too many connections from %s (%d)", ip, cl.perIP[ip])
+	}
+	cl.total++
+	cl.perIP[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cl.m.Lock()
+			defer cl.m.Unlock()
+			cl.total--
+			if cl.perIP[ip]--; cl.perIP[ip] == 0 {
+				delete(cl.perIP, ip)
+			}
+		})
+	}, nil
+}
+
+// limitedConn releases its connLimiter slot on Close
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestConnLimiter(t *testing.T) {
+	cl := newConnLimiter(3, 2)
+
+	a1, err := cl.acquire("10.0.0.1:1000")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := cl.acquire("10.0.0.1:1001"); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := cl.acquire("10.0.0.1:1002"); err == nil {
+		t.Fatal("acquire over the limit per IP passed")
+	}
+	if _, err := cl.acquire("10.0.0.2:1000"); err != nil {
+		t.Fatalf("acquire of another IP: %v", err)
+	}
+	if _, err := cl.acquire("10.0.0.3:1000"); err == nil {
+		t.Fatal("acquire over the total limit passed")
+	}
+
+	// release returns the slot only once
+	a1()
+	a1()
+	if cl.total != 2 || cl.perIP["10.0.0.1"] != 1 {
+		t.Fatalf("after release: total %d, per IP %d, want 2 and 1", cl.total, cl.perIP["10.0.0.1"])
+	}
+	a3, err := cl.acquire("10.0.0.3:1000")
+	if err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	a3()
+	if _, found := cl.perIP["10.0.0.3"]; found {
+		t.Error("released IP is still counted")
+	}
+}
+
+func TestConnLimiterUnlimited(t *testing.T) {
+	cl := newConnLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if _, err := cl.acquire("10.0.0.1:1000"); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+}
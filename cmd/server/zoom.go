@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/scheduler"
+)
+
+var _ renderJob = &zoomWorkScheduler{}
+
+// zoomWorkScheduler manages rendering of a zoom animation.
+// Each frame is rendered by its own scheduler.ImgWorkScheduler, work units are (frame, tile) pairs.
+// Frames are started in order, so only a few frames are held in memory at once.
+// Finished frames are saved as numbered PNGs to outDir, animated GIF is written once all frames are done.
+// zoomWorkScheduler provides its image for api.ImgProvider and implements most of api.TileProvider
+type zoomWorkScheduler struct {
+	w, h      int
+	from, to  api.MandelRegion
+	params    api.RenderParams
+	outDir    string
+	tileSize  int
+	maxCopies int                  // copies of a tile rendered at once, see scheduler.DefaultMaxTileCopies
+	cache     *scheduler.TileCache // nil disables caching
+
+	// frames holds schedulers of frames in process. Not yet started and already saved frames are nil.
+	frames         []*scheduler.ImgWorkScheduler
+	nextFrame      int // index of the next frame to be started
+	finishedFrames int
+	lastFrame      *scheduler.ImgWorkScheduler // kept for GetImage
+	gifFrames      []*image.Paletted
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	m         sync.Mutex
+}
+
+// newZoomWorkScheduler creates zoom animation of frames w×h images, zooming exponentially from region from to region to.
+func newZoomWorkScheduler(w, h int, from, to api.MandelRegion, frames int, params api.RenderParams, outDir string, tileSize, maxCopies int, cache *scheduler.TileCache) *zoomWorkScheduler {
+	frames = max(frames, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &zoomWorkScheduler{
+		w:         w,
+		h:         h,
+		from:      from,
+		to:        to,
+		params:    params,
+		outDir:    outDir,
+		tileSize:  tileSize,
+		maxCopies: maxCopies,
+		cache:     cache,
+		frames:    make([]*scheduler.ImgWorkScheduler, frames),
+		gifFrames: make([]*image.Paletted, frames),
+		ctx:       ctx,
+		ctxCancel: cancel,
+	}
+}
+
+// zoomRegion returns region of frame at t (0..1) between from and to.
+// Region size changes exponentially, so the zoom speed is constant.
+// Center moves proportionally to the size, so the target stays in place on the screen.
+func zoomRegion(from, to api.MandelRegion, t float64) api.MandelRegion {
+	fromW, toW := from.Xmax-from.Xmin, to.Xmax-to.Xmin
+	fromH, toH := from.Ymax-from.Ymin, to.Ymax-to.Ymin
+
+	w := fromW * math.Pow(toW/fromW, t)
+	h := fromH * math.Pow(toH/fromH, t)
+
+	// fraction of the way in terms of size
+	f := 1.0
+	if fromW != toW {
+		f = (fromW - w) / (fromW - toW)
+	}
+	cx := lerp((from.Xmin+from.Xmax)/2, (to.Xmin+to.Xmax)/2, f)
+	cy := lerp((from.Ymin+from.Ymax)/2, (to.Ymin+to.Ymax)/2, f)
+
+	return api.MandelRegion{Xmin: cx - w/2, Xmax: cx + w/2, Ymin: cy - h/2, Ymax: cy + h/2}
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// frameRegion returns region of frame i
+func (zws *zoomWorkScheduler) frameRegion(i int) api.MandelRegion {
+	if len(zws.frames) == 1 {
+		return zws.to
+	}
+	return zoomRegion(zws.from, zws.to, float64(i)/float64(len(zws.frames)-1))
+}
+
+// PopWork implements scheduler.WorkSource
+// unit of work is a single tile of a single frame
+func (zws *zoomWorkScheduler) PopWork() (scheduler.WorkUnit, bool) {
+	frameIdx, frame, tile, found := zws.popTile()
+	if !found {
+		return nil, false
+	}
+	return func(ctx context.Context, renderer api.Renderer) error {
+		completed, err := frame.RenderTile(ctx, renderer, tile)
+		if err != nil {
+			return fmt.Errorf("render of frame %d tile %s failed: %w", frameIdx, tile, err)
+		}
+		if completed {
+			zws.finishFrame(frameIdx, frame)
+		}
+		return nil
+	}, true
+}
+
+// popTile returns unstarted tile of the earliest frame, starting new frames as needed.
+// If all frames are started and there is no unstarted tile, tiles in process are handed out again.
+func (zws *zoomWorkScheduler) popTile() (frameIdx int, frame *scheduler.ImgWorkScheduler, tile image.Rectangle, found bool) {
+	zws.m.Lock()
+	defer zws.m.Unlock()
+
+	for i, f := range zws.frames[:zws.nextFrame] {
+		if f == nil {
+			continue
+		}
+		if tile, found := f.PopUnstartedTile(); found {
+			return i, f, tile, true
+		}
+	}
+
+	for zws.nextFrame < len(zws.frames) {
+		i := zws.nextFrame
+		f := scheduler.NewImgWorkScheduler(scheduler.NewMemTileStore(zws.w, zws.h), zws.frameRegion(i), zws.params, zws.tileSize, zws.maxCopies, zws.cache)
+		zws.frames[i] = f
+		zws.nextFrame++
+		if tile, found := f.PopUnstartedTile(); found {
+			return i, f, tile, true
+		}
+		// whole frame was loaded from the cache. finishFrame needs zws.m, which we hold
+		go zws.finishFrame(i, f)
+	}
+
+	for i, f := range zws.frames {
+		if f == nil {
+			continue
+		}
+		if tile, found := f.PopInProcessTile(); found {
+			return i, f, tile, true
+		}
+	}
+
+	return 0, nil, image.Rectangle{}, false
+}
+
+// RejectWorker implements scheduler.WorkerRejecter
+// Frames in process render tiles of worker id again. Saved frames are kept, their tiles are removed from the cache by the cache.
+func (zws *zoomWorkScheduler) RejectWorker(id uint64) {
+	zws.m.Lock()
+	frames := slices.Clone(zws.frames)
+	zws.m.Unlock()
+
+	for _, f := range frames {
+		if f != nil {
+			f.RejectWorker(id)
+		}
+	}
+}
+
+// finishFrame saves completed frame and releases its memory
+// once the last frame is finished, animated gif is written
+// failure to save is only logged, so that the animation still finishes
+func (zws *zoomWorkScheduler) finishFrame(i int, frame *scheduler.ImgWorkScheduler) {
+	img, _ := frame.GetImage()
+
+	name := filepath.Join(zws.outDir, fmt.Sprintf("frame_%05d.png", i))
+	if err := savePNG(name, img); err != nil {
+		log.Printf("zoom: save frame %d: %v", i, err)
+	}
+
+	paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+
+	zws.m.Lock()
+	zws.gifFrames[i] = paletted
+	zws.frames[i] = nil
+	zws.finishedFrames++
+	if i == len(zws.frames)-1 {
+		zws.lastFrame = frame
+	}
+	finishedFrames := zws.finishedFrames
+	zws.m.Unlock()
+
+	log.Printf("zoom: frame %d finished (%d/%d)", i, finishedFrames, len(zws.frames))
+
+	if finishedFrames < len(zws.frames) {
+		return
+	}
+
+	// all frames are finished, so nobody else touches gifFrames
+	gifName := filepath.Join(zws.outDir, "zoom.gif")
+	if err := saveGIF(gifName, zws.gifFrames); err != nil {
+		log.Printf("zoom: save animation: %v", err)
+	} else {
+		log.Printf("zoom: animation saved to %q", gifName)
+	}
+
+	zws.ctxCancel()
+}
+
+// currentFrame returns the earliest unfinished frame, which is the one shown to web clients
+// returns nil if the frame is not started yet
+func (zws *zoomWorkScheduler) currentFrame() (int, *scheduler.ImgWorkScheduler) {
+	zws.m.Lock()
+	defer zws.m.Unlock()
+
+	if zws.finishedFrames == len(zws.frames) {
+		return len(zws.frames) - 1, zws.lastFrame
+	}
+	for i, f := range zws.frames {
+		if f != nil || i >= zws.nextFrame {
+			return i, f
+		}
+	}
+	return len(zws.frames) - 1, nil
+}
+
+// Frames implements api.TileProvider
+func (zws *zoomWorkScheduler) Frames() (current, total int, err error) {
+	current, _ = zws.currentFrame()
+	return current, len(zws.frames), nil
+}
+
+// FinishedTiles implements api.TileProvider
+// returns finished tiles of the current frame
+func (zws *zoomWorkScheduler) FinishedTiles() (map[image.Rectangle]struct{}, error) {
+	_, f := zws.currentFrame()
+	if f == nil {
+		return map[image.Rectangle]struct{}{}, nil
+	}
+	return f.FinishedTiles()
+}
+
+// GetTileImg implements api.TileProvider
+// returns tile of the current frame
+func (zws *zoomWorkScheduler) GetTileImg(rect image.Rectangle) (*image.RGBA, error) {
+	_, f := zws.currentFrame()
+	if f == nil {
+		return image.NewRGBA(rect), nil
+	}
+	return f.GetTileImg(rect)
+}
+
+// FullImageDimensions implements api.TileProvider
+func (zws *zoomWorkScheduler) FullImageDimensions() (width, height int, err error) {
+	return zws.w, zws.h, nil
+}
+
+// TotalTilesCount implements api.TileProvider
+// returns tiles count of a single frame
+func (zws *zoomWorkScheduler) TotalTilesCount() (int, error) {
+	return len(scheduler.SplitRectNoClip(image.Rect(0, 0, zws.w, zws.h), zws.tileSize, zws.tileSize)), nil
+}
+
+// GetImage implements renderJob
+// blocks until all frames are rendered and returns the last one
+func (zws *zoomWorkScheduler) GetImage() (*image.RGBA64, error) {
+	<-zws.ctx.Done()
+	return zws.lastFrame.GetImage()
+}
+
+// Progress implements renderJob
+// frames in process contribute by their finished fraction
+func (zws *zoomWorkScheduler) Progress() (float64, error) {
+	zws.m.Lock()
+	defer zws.m.Unlock()
+
+	done := float64(zws.finishedFrames)
+	for _, f := range zws.frames {
+		if f != nil {
+			progress, _ := f.Progress()
+			done += progress
+		}
+	}
+	return done / float64(len(zws.frames)), nil
+}
+
+// GetImageRows implements renderJob
+// returns rows of the last frame, once all frames are finished
+func (zws *zoomWorkScheduler) GetImageRows(ctx context.Context, y, n int) (*image.RGBA64, error) {
+	return finalImageRows(ctx, zws, y, n)
+}
+
+// Done implements renderJob
+func (zws *zoomWorkScheduler) Done() <-chan struct{} {
+	return zws.ctx.Done()
+}
+
+// savePNG saves img to filename, creating its directory if needed
+func savePNG(filename string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		return fmt.Errorf("png.Encode: %w", err)
+	}
+	return f.Close()
+}
+
+// saveGIF saves frames as an endlessly looping animation
+func saveGIF(filename string, frames []*image.Paletted) error {
+	anim := &gif.GIF{
+		Image: frames,
+		Delay: make([]int, len(frames)),
+	}
+	for i := range anim.Delay {
+		anim.Delay[i] = 4 // in 100ths of a second
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	defer f.Close()
+
+	if err := gif.EncodeAll(f, anim); err != nil {
+		return fmt.Errorf("gif.EncodeAll: %w", err)
+	}
+	return f.Close()
+}
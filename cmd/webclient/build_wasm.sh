@@ -14,3 +14,4 @@ echo "✓ WASM compiled to ../server/static/main.wasm"
 cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" ../server/static/
 
 echo "✓ Copied wasm_exec.js to ../server/static/"
+echo "Rebuild the server to embed them, or run it with -static-dir ./static"
@@ -30,13 +30,22 @@ func main() {
 	if loc.Get("protocol").String() == "https:" {
 		proto = "wss"
 	}
-	websocketUrl := proto + "://" + host + "/ws"
+	// access token of servers requiring one is passed in the page's query (index.html?token=...)
+	serverUrl := proto + "://" + host + "/ws"
+	websocketUrl := serverUrl + loc.Get("search").String()
 
 	// Step 2: Connect to server via WebSocket
-	logScreenf("Connecting to Mandelbrot server at %s...", websocketUrl)
+	// the query is not logged, so that the token doesn't end up on the screen
+	logScreenf("Connecting to Mandelbrot server at %s...", serverUrl)
 	websocket := js.Global().Get("WebSocket").New(websocketUrl)
 	websocketRWC := NewWebsocketReadWriteCloser(websocket)
 	logScreenf("WebSocket connected.")
+	// leaving the page closes the connection right away, so the server hands out our tiles to other workers
+	// (tabs that are suspended or killed without pagehide are noticed by the server's pings)
+	js.Global().Get("window").Call("addEventListener", "pagehide", js.FuncOf(func(js.Value, []js.Value) any {
+		websocket.Call("close", 1001, "page closed") // 1001 = going away
+		return nil
+	}))
 
 	// Step 3: Set up IRPC endpoint and renderer service
 	renderer := render.RendererImpl{OnTileRender: func(tile image.Rectangle) { logScreenf("Rendering tile: %s", tile) }}
@@ -99,7 +108,19 @@ func tilesLoadLoop(tp api.TileProvider) error {
 	hudSetTotalTiles(totalTiles)
 
 	ourFinishedTiles := make(map[image.Rectangle]struct{})
+	ourFrame := 0
 	for {
+		// Animations render multiple frames. Once the server moves to next frame, we redraw all tiles
+		frame, totalFrames, err := tp.Frames()
+		if err != nil {
+			return fmt.Errorf("tp.Frames: %w", err)
+		}
+		if frame != ourFrame {
+			ourFinishedTiles = make(map[image.Rectangle]struct{})
+			ourFrame = frame
+		}
+		hudSetFrame(frame, totalFrames)
+
 		finishedTiles, err := tp.FinishedTiles()
 		if err != nil {
 			return fmt.Errorf("FinishedTiles: %w", err)
@@ -143,6 +164,14 @@ func hudSetFinishedTiles(finished int) {
 	js.Global().Get("document").Call("getElementById", "tilesDone").Set("textContent", finished)
 }
 
+// hudSetFrame updates the HUD to show the frame being rendered.
+// frame: zero based index of the frame, total: total number of frames in the job.
+func hudSetFrame(frame, total int) {
+	doc := js.Global().Get("document")
+	doc.Call("getElementById", "frameCurrent").Set("textContent", frame+1)
+	doc.Call("getElementById", "framesTotal").Set("textContent", total)
+}
+
 // hudSetTotalTiles updates the HUD to show the total number of tiles to be rendered.
 // total: total number of tiles in the image.
 func hudSetTotalTiles(total int) {
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Clients connecting over tcp authenticate by a handshake before irpc starts on the connection.
+// The client sends its access token (empty if it has none) on a single line.
+// The server answers "ok" on a single line, or the reason of rejection and closes the connection.
+// Web clients pass the token as "token" query parameter of the websocket url instead.
+
+// ErrUnauthorized is returned by ClientHandshake when the server rejects the token
+var ErrUnauthorized = errors.New("unauthorized")
+
+// maxHandshakeLine limits length of handshake lines
+const maxHandshakeLine = 1024
+
+const handshakeOK = "ok"
+
+// ClientHandshake sends token to the server and reads its answer
+func ClientHandshake(rw io.ReadWriter, token string) error {
+	if strings.ContainsAny(token, "\r\n") {
+		return errors.New("token contains line break")
+	}
+	if _, err := io.WriteString(rw, token+"\n"); err != nil {
+		return fmt.Errorf("write token: %w", err)
+	}
+	answer, err := readLine(rw)
+	if err != nil {
+		return fmt.Errorf("read answer: %w", err)
+	}
+	if answer != handshakeOK {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, answer)
+	}
+	return nil
+}
+
+// ReadHandshakeToken reads token sent by ClientHandshake
+func ReadHandshakeToken(r io.Reader) (string, error) {
+	return readLine(r)
+}
+
+// WriteHandshakeAnswer accepts the client if authErr is nil, or sends it the reason of rejection
+func WriteHandshakeAnswer(w io.Writer, authErr error) error {
+	answer := handshakeOK
+	if authErr != nil {
+		answer = strings.NewReplacer("\r", " ", "\n", " ").Replace(authErr.Error())
+	}
+	_, err := io.WriteString(w, answer+"\n")
+	return err
+}
+
+// readLine reads a line byte by byte, so that nothing after it is consumed from r
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < maxHandshakeLine {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("handshake line too long")
+}
@@ -0,0 +1,126 @@
+// Package pngstream writes 16 bit RGBA png images row band by row band,
+// so that images don't have to be held in memory as a whole.
+// It is used by the server for images larger than memory and by the cli client to save images while they are received.
+package pngstream
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+// Writer writes rows of a png image in order, top to bottom.
+// Pixels are written as stored in image.RGBA64, which matches png's non-premultiplied alpha
+// for opaque and fully transparent pixels.
+type Writer struct {
+	width, height int
+	next          int // next row to be written
+	idat          *bufio.Writer
+	zw            *zlib.Writer
+	w             io.Writer
+}
+
+// NewWriter writes png header of width×height image to w
+func NewWriter(w io.Writer, width, height int) (*Writer, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image dimensions %dx%d", width, height)
+	}
+
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 16 // bit depth
+	ihdr[9] = 6  // color type RGBA. compression, filter and interlace methods are 0
+	if err := writeChunk(w, "IHDR", ihdr); err != nil {
+		return nil, err
+	}
+
+	// compressed rows are split into IDAT chunks by the buffer size
+	idat := bufio.NewWriterSize(chunkWriter{w: w, typ: "IDAT"}, 1<<16)
+	return &Writer{
+		width:  width,
+		height: height,
+		idat:   idat,
+		zw:     zlib.NewWriter(idat),
+		w:      w,
+	}, nil
+}
+
+// WriteRows writes all rows of rows. rows must span the whole image width
+// and start at the first row not written yet.
+func (pw *Writer) WriteRows(rows *image.RGBA64) error {
+	b := rows.Bounds()
+	if b.Min.X != 0 || b.Dx() != pw.width {
+		return fmt.Errorf("rows %s don't span image width %d", b, pw.width)
+	}
+	if b.Min.Y != pw.next || b.Max.Y > pw.height {
+		return fmt.Errorf("rows %s out of order, expected rows from %d up to %d", b, pw.next, pw.height)
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		// every row starts with its filter type. We don't filter
+		if _, err := pw.zw.Write([]byte{0}); err != nil {
+			return err
+		}
+		if _, err := pw.zw.Write(rows.Pix[rows.PixOffset(0, y):rows.PixOffset(pw.width, y)]); err != nil {
+			return err
+		}
+	}
+	pw.next = b.Max.Y
+	return nil
+}
+
+// Close finishes the image. All rows must be written by then.
+// Close doesn't close the underlying writer.
+func (pw *Writer) Close() error {
+	if pw.next != pw.height {
+		return fmt.Errorf("only %d of %d rows written", pw.next, pw.height)
+	}
+	if err := pw.zw.Close(); err != nil {
+		return err
+	}
+	if err := pw.idat.Flush(); err != nil {
+		return err
+	}
+	return writeChunk(pw.w, "IEND", nil)
+}
+
+// writeChunk writes png chunk of type typ: length, type, data and crc of type and data
+func writeChunk(w io.Writer, typ string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	for _, b := range [][]byte{header[:], data, footer[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkWriter writes every Write as a separate chunk of type typ
+type chunkWriter struct {
+	w   io.Writer
+	typ string
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if err := writeChunk(cw.w, cw.typ, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
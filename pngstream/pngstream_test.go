@@ -0,0 +1,74 @@
+package pngstream
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// TestWriterDecodes writes an image in bands of rows and decodes it by image/png
+func TestWriterDecodes(t *testing.T) {
+	const w, h = 37, 21 // bands don't divide the height
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			c := color.RGBA64{R: uint16(x * 1771), G: uint16(y * 3001), B: uint16(x*y*13 + 1), A: 0xffff}
+			if (x+y)%7 == 0 {
+				c = color.RGBA64{} // transparent
+			}
+			img.SetRGBA64(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	pw, err := NewWriter(&buf, w, h)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for y := 0; y < h; y += 8 {
+		if err := pw.WriteRows(img.SubImage(image.Rect(0, y, w, min(y+8, h))).(*image.RGBA64)); err != nil {
+			t.Fatalf("WriteRows(%d): %v", y, err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode: %v", err)
+	}
+	if decoded.Bounds() != img.Rect {
+		t.Fatalf("decoded bounds %s, want %s", decoded.Bounds(), img.Rect)
+	}
+	for y := range h {
+		for x := range w {
+			// opaque and transparent pixels are the same premultiplied or not
+			want := img.RGBA64At(x, y)
+			if got := color.RGBA64Model.Convert(decoded.At(x, y)).(color.RGBA64); got != want {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestWriterRowsOrder(t *testing.T) {
+	pw, err := NewWriter(&bytes.Buffer{}, 4, 4)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := pw.WriteRows(image.NewRGBA64(image.Rect(0, 1, 4, 2))); err == nil {
+		t.Error("WriteRows accepted rows out of order")
+	}
+	if err := pw.WriteRows(image.NewRGBA64(image.Rect(0, 0, 3, 1))); err == nil {
+		t.Error("WriteRows accepted rows narrower than the image")
+	}
+	if err := pw.WriteRows(image.NewRGBA64(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatalf("WriteRows: %v", err)
+	}
+	if err := pw.Close(); err == nil {
+		t.Error("Close accepted image with missing rows")
+	}
+}
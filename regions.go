@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+// Classic regions / landmarks in the Mandelbrot set
+// You can replace them in cmd/server/main.go to render different parts of mandelbrot set
+// or pass their names from Regions to cli client's -preset flag
+var (
+	// Full Set – whole set in 16:9, best for Buddhabrot / Nebulabrot jobs
+	FullSet = MandelRegion{
+		Xmin: -2.5,
+		Xmax: 1.5,
+		Ymin: -1.125,
+		Ymax: 1.125,
+	}
+
+	// Seahorse Valley – dense filaments and repeating “seahorse” curls
+	SeahorseValley = MandelRegion{
+		Xmin: -0.8,
+		Xmax: -0.7,
+		Ymin: 0.05,
+		Ymax: 0.15,
+	}
+
+	// Elephant Valley – large bulb with trunk-like tendrils
+	ElephantValley = MandelRegion{
+		Xmin: -1.85,
+		Xmax: -1.75,
+		Ymin: -0.10,
+		Ymax: -0.02,
+	}
+
+	// Spiral Minibrot – small Mandelbrot copy with tight spiral arms
+	SpiralMinibrot = MandelRegion{
+		Xmin: -0.7435,
+		Xmax: -0.7420,
+		Ymin: 0.1310,
+		Ymax: 0.1325,
+	}
+
+	// Triple Spiral – threefold symmetric spiral structure
+	TripleSpiral = MandelRegion{
+		Xmin: -0.7480,
+		Xmax: -0.7450,
+		Ymin: 0.0950,
+		Ymax: 0.0980,
+	}
+
+	// Valley of the Dragon – deep, highly detailed spiral filaments
+	ValleyOfTheDragon = MandelRegion{
+		Xmin: -0.7400,
+		Xmax: -0.7350,
+		Ymin: 0.1800,
+		Ymax: 0.1850,
+	}
+
+	// Minibrot in a Mini-Spiral – self-similar Mandelbrot copy inside a spiral arm
+	MinibrotInMiniSpiral = MandelRegion{
+		Xmin: -1.7390,
+		Xmax: -1.7375,
+		Ymin: -0.0235,
+		Ymax: -0.0220,
+	}
+)
+
+// Regions maps preset names to the classic regions
+var Regions = map[string]MandelRegion{
+	"full-set":                FullSet,
+	"seahorse-valley":         SeahorseValley,
+	"elephant-valley":         ElephantValley,
+	"spiral-minibrot":         SpiralMinibrot,
+	"triple-spiral":           TripleSpiral,
+	"valley-of-the-dragon":    ValleyOfTheDragon,
+	"minibrot-in-mini-spiral": MinibrotInMiniSpiral,
+}
+
+// RegionNames returns sorted names of Regions
+func RegionNames() []string {
+	return slices.Sorted(maps.Keys(Regions))
+}
+
+// Validate returns error unless region has finite bounds and positive finite size
+func (r MandelRegion) Validate() error {
+	for _, v := range []float64{r.Xmin, r.Xmax, r.Ymin, r.Ymax} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid region %+v: bounds must be finite", r)
+		}
+	}
+	w, h := r.Xmax-r.Xmin, r.Ymax-r.Ymin
+	if math.IsInf(w, 0) || math.IsInf(h, 0) || w <= 0 || h <= 0 {
+		return fmt.Errorf("invalid region %+v: size must be positive and finite", r)
+	}
+	return nil
+}
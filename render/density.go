@@ -0,0 +1,182 @@
+package render
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// densitySampleArea is the area random points c are taken from.
+// Orbits of points outside of the rendered region often pass through it, so we sample the whole set.
+var densitySampleArea = api.MandelRegion{Xmin: -2, Xmax: 2, Ymin: -2, Ymax: 2}
+
+func (imp RendererImpl) RenderDensity(job api.DensityJob, seed uint64) (*api.DensityGrid, error) {
+	if imp.OnDensityRender != nil {
+		imp.OnDensityRender(seed)
+	}
+
+	grid := &api.DensityGrid{
+		W:        job.W,
+		H:        job.H,
+		Channels: len(job.MaxIters),
+	}
+	if len(job.MaxIters) == 0 {
+		return grid, nil
+	}
+	allCounts := make([]uint32, job.W*job.H*len(job.MaxIters))
+
+	maxIter := slices.Max(job.MaxIters)
+	orbit := make([]complex128, 0, maxIter)
+	rnd := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	r := job.Region
+	a := densitySampleArea
+	chanSize := job.W * job.H
+
+	for range job.Samples {
+		c := complex(
+			a.Xmin+rnd.Float64()*(a.Xmax-a.Xmin),
+			a.Ymin+rnd.Float64()*(a.Ymax-a.Ymin),
+		)
+		if inMainBulbs(c) {
+			// never escapes
+			continue
+		}
+
+		var escaped bool
+		orbit, escaped = escapingOrbit(c, maxIter, orbit[:0])
+		if !escaped || len(orbit) < job.MinIter {
+			continue
+		}
+
+		for ch, chMaxIter := range job.MaxIters {
+			if len(orbit) >= chMaxIter {
+				continue
+			}
+			counts := allCounts[ch*chanSize : (ch+1)*chanSize]
+			for _, z := range orbit {
+				// floor, not truncation toward zero, so that points just left of or above the region don't hit its first column or row
+				px := int(math.Floor((real(z) - r.Xmin) / (r.Xmax - r.Xmin) * float64(job.W)))
+				py := int(math.Floor((imag(z) - r.Ymin) / (r.Ymax - r.Ymin) * float64(job.H)))
+				if px < 0 || py < 0 || px >= job.W || py >= job.H {
+					continue
+				}
+				counts[py*job.W+px]++
+			}
+		}
+	}
+
+	grid.Hits = encodeDensityHits(allCounts)
+
+	time.Sleep(api.RenderTileSleepTime)
+
+	return grid, nil
+}
+
+// encodeDensityHits encodes non-zero counts as api.DensityGrid.Hits
+func encodeDensityHits(counts []uint32) []byte {
+	var hits []byte
+	skipped := uint64(0)
+	for _, c := range counts {
+		if c == 0 {
+			skipped++
+			continue
+		}
+		hits = binary.AppendUvarint(hits, skipped)
+		hits = binary.AppendUvarint(hits, uint64(c))
+		skipped = 0
+	}
+	return hits
+}
+
+// forEachDensityHit calls f (if not nil) for each hit cell of api.DensityGrid.Hits.
+// Hits come from workers, so error is returned if they are malformed or don't fit into cells.
+func forEachDensityHit(hits []byte, cells int, f func(cell int, count uint32)) error {
+	cell := -1
+	for len(hits) > 0 {
+		skipped, n := binary.Uvarint(hits)
+		if n <= 0 {
+			return errors.New("malformed density hits")
+		}
+		hits = hits[n:]
+		count, n := binary.Uvarint(hits)
+		if n <= 0 || count > math.MaxUint32 {
+			return errors.New("malformed density hits")
+		}
+		hits = hits[n:]
+		if skipped >= uint64(cells-cell-1) {
+			return fmt.Errorf("density hit out of %d cells", cells)
+		}
+		cell += int(skipped) + 1
+		if f != nil {
+			f(cell, uint32(count))
+		}
+	}
+	return nil
+}
+
+// escapingOrbit appends orbit of c to buf
+// escaped is false if c doesn't escape within maxIter iterations
+func escapingOrbit(c complex128, maxIter int, buf []complex128) (orbit []complex128, escaped bool) {
+	z := complex(0, 0)
+	for range maxIter {
+		z = z*z + c
+		if real(z)*real(z)+imag(z)*imag(z) > 4 {
+			return buf, true
+		}
+		buf = append(buf, z)
+	}
+	return buf, false
+}
+
+// inMainBulbs reports whether c lies in the main cardioid or the period-2 bulb
+func inMainBulbs(c complex128) bool {
+	x, y := real(c), imag(c)
+	q := (x-0.25)*(x-0.25) + y*y
+	if q*(q+(x-0.25)) <= 0.25*y*y {
+		return true
+	}
+	return (x+1)*(x+1)+y*y <= 1.0/16
+}
+
+// AddDensity sums hits of grid into sum, which holds counts of all cells of the same dimensions.
+// Malformed hits return error and leave sum unchanged.
+func AddDensity(sum []uint64, grid *api.DensityGrid) error {
+	if err := forEachDensityHit(grid.Hits, len(sum), nil); err != nil {
+		return err
+	}
+	return forEachDensityHit(grid.Hits, len(sum), func(cell int, count uint32) { sum[cell] += uint64(count) })
+}
+
+// ColorizeDensity renders summed hit counts of w×h grid with given channels count.
+// Single channel is rendered in grayscale, multiple channels as red, green and blue (Nebulabrot).
+// Counts are normalized per channel with square root to bring out faint orbits.
+func ColorizeDensity(sum []uint64, w, h, channels int) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	chanSize := w * h
+
+	maxCounts := make([]float64, channels)
+	for ch := range channels {
+		maxCounts[ch] = float64(max(slices.Max(sum[ch*chanSize:(ch+1)*chanSize]), 1))
+	}
+
+	var v [3]float64
+	for i := range chanSize {
+		for ch := range min(channels, 3) {
+			v[ch] = math.Sqrt(float64(sum[ch*chanSize+i]) / maxCounts[ch])
+		}
+		col := color.RGBA64{to16bit(v[0]), to16bit(v[1]), to16bit(v[2]), 0xffff}
+		if channels == 1 {
+			col.G, col.B = col.R, col.R
+		}
+		img.SetRGBA64(i%w, i/w, col)
+	}
+	return img
+}
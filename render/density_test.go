@@ -0,0 +1,46 @@
+package render
+
+import (
+	"slices"
+	"testing"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+func TestAddDensity(t *testing.T) {
+	counts := []uint32{0, 3, 0, 0, 1, 200, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 70000}
+	sum := make([]uint64, len(counts))
+	sum[1] = 10
+
+	if err := AddDensity(sum, &api.DensityGrid{Hits: encodeDensityHits(counts)}); err != nil {
+		t.Fatalf("AddDensity: %v", err)
+	}
+	want := []uint64{0, 13, 0, 0, 1, 200, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 70000}
+	if !slices.Equal(sum, want) {
+		t.Errorf("sum = %v, want %v", sum, want)
+	}
+}
+
+func TestAddDensityMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hits []byte
+	}{
+		{"beyond last cell", encodeDensityHits([]uint32{0, 0, 0, 0, 1})},
+		{"missing count", []byte{0}},
+		{"truncated varint", []byte{0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum := make([]uint64, 4)
+			// the first cell is valid, but must not be added either
+			hits := append([]byte{0, 1}, tt.hits...)
+			if err := AddDensity(sum, &api.DensityGrid{Hits: hits}); err == nil {
+				t.Error("AddDensity returned no error")
+			}
+			if !slices.Equal(sum, make([]uint64, 4)) {
+				t.Errorf("sum changed to %v", sum)
+			}
+		})
+	}
+}
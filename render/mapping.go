@@ -0,0 +1,48 @@
+package render
+
+import (
+	"math"
+	"math/cmplx"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// PixelToC returns point of the complex plane at pixel (px, py) of imgW×imgH image.
+func PixelToC(r api.MandelRegion, m api.Mapping, imgW, imgH int, px, py float64) complex128 {
+	if m == api.MappingExp {
+		angle := 2 * math.Pi * px / float64(imgW)
+		radius := expMapRadius(r) * math.Exp(-2*math.Pi*py/float64(imgW))
+		return expMapCenter(r) + cmplx.Rect(radius, angle)
+	}
+
+	return complex(
+		r.Xmin+(px/float64(imgW))*(r.Xmax-r.Xmin),
+		r.Ymin+(py/float64(imgH))*(r.Ymax-r.Ymin),
+	)
+}
+
+// ExpMapPixel returns (fractional) pixel of exponential map of width imgW, which shows point c.
+// It is inverse of PixelToC for api.MappingExp. Returned px is in range 0..imgW.
+func ExpMapPixel(r api.MandelRegion, imgW int, c complex128) (px, py float64) {
+	radius, angle := cmplx.Polar(c - expMapCenter(r))
+	if angle < 0 {
+		angle += 2 * math.Pi
+	}
+	px = angle / (2 * math.Pi) * float64(imgW)
+	py = math.Log(expMapRadius(r)/radius) * float64(imgW) / (2 * math.Pi)
+	return px, py
+}
+
+// ExpMapDepth returns number of rows of exponential map of width imgW needed to zoom in by factor zoom.
+func ExpMapDepth(imgW int, zoom float64) int {
+	return int(math.Ceil(math.Log(zoom) * float64(imgW) / (2 * math.Pi)))
+}
+
+func expMapCenter(r api.MandelRegion) complex128 {
+	return complex((r.Xmin+r.Xmax)/2, (r.Ymin+r.Ymax)/2)
+}
+
+// expMapRadius is the distance of region corners from its center
+func expMapRadius(r api.MandelRegion) float64 {
+	return math.Hypot(r.Xmax-r.Xmin, r.Ymax-r.Ymin) / 2
+}
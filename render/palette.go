@@ -0,0 +1,214 @@
+package render
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// defaultPaletteCycle is used when api.RenderParams.PaletteCycle is not set
+const defaultPaletteCycle = 50
+
+// hsvPalette is the classic full hue sweep. It is used for palettes without stops.
+var hsvPalette = api.Palette{
+	Name: "hsv",
+	Stops: []api.GradientStop{
+		{Pos: 0, R: 255},
+		{Pos: 1.0 / 6, R: 255, G: 255},
+		{Pos: 2.0 / 6, G: 255},
+		{Pos: 3.0 / 6, G: 255, B: 255},
+		{Pos: 4.0 / 6, B: 255},
+		{Pos: 5.0 / 6, R: 255, B: 255},
+		{Pos: 1, R: 255},
+	},
+}
+
+// Built-in palettes
+var (
+	palettesM sync.RWMutex
+	palettes  = map[string]api.Palette{
+		hsvPalette.Name: hsvPalette,
+		"ultra": {
+			Name:  "ultra",
+			Space: api.ColorSpaceOKLab,
+			Stops: []api.GradientStop{
+				{Pos: 0, R: 0, G: 7, B: 100},
+				{Pos: 0.16, R: 32, G: 107, B: 203},
+				{Pos: 0.42, R: 237, G: 255, B: 255},
+				{Pos: 0.6425, R: 255, G: 170, B: 0},
+				{Pos: 0.8575, R: 0, G: 2, B: 0},
+				{Pos: 1, R: 0, G: 7, B: 100},
+			},
+		},
+		"fire": {
+			Name: "fire",
+			Stops: []api.GradientStop{
+				{Pos: 0, R: 0, G: 0, B: 0},
+				{Pos: 0.3, R: 180, G: 20, B: 0},
+				{Pos: 0.6, R: 255, G: 160, B: 0},
+				{Pos: 0.85, R: 255, G: 255, B: 200},
+				{Pos: 1, R: 0, G: 0, B: 0},
+			},
+		},
+		"ocean": {
+			Name:  "ocean",
+			Space: api.ColorSpaceOKLab,
+			Stops: []api.GradientStop{
+				{Pos: 0, R: 2, G: 12, B: 40},
+				{Pos: 0.4, R: 0, G: 110, B: 160},
+				{Pos: 0.7, R: 120, G: 220, B: 220},
+				{Pos: 1, R: 2, G: 12, B: 40},
+			},
+		},
+		"grayscale": {
+			Name: "grayscale",
+			Stops: []api.GradientStop{
+				{Pos: 0, R: 0, G: 0, B: 0},
+				{Pos: 0.5, R: 255, G: 255, B: 255},
+				{Pos: 1, R: 0, G: 0, B: 0},
+			},
+		},
+	}
+)
+
+// RegisterPalette adds p to the palette registry, replacing palette of the same name.
+func RegisterPalette(p api.Palette) {
+	palettesM.Lock()
+	defer palettesM.Unlock()
+
+	palettes[p.Name] = p
+}
+
+// LookupPalette returns registered palette of given name.
+func LookupPalette(name string) (api.Palette, bool) {
+	palettesM.RLock()
+	defer palettesM.RUnlock()
+
+	p, found := palettes[name]
+	return p, found
+}
+
+// PaletteNames returns sorted names of all registered palettes.
+func PaletteNames() []string {
+	palettesM.RLock()
+	defer palettesM.RUnlock()
+
+	names := make([]string, 0, len(palettes))
+	for n := range palettes {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// gradientStop is api.GradientStop converted to the interpolation color space
+type gradientStop struct {
+	pos     float64
+	a, b, c float64
+}
+
+// Gradient evaluates colors of a palette.
+type Gradient struct {
+	stops []gradientStop
+	space api.ColorSpace
+}
+
+// NewGradient prepares palette p for evaluation.
+// Palette without stops yields the classic hsv sweep.
+func NewGradient(p api.Palette) *Gradient {
+	if len(p.Stops) == 0 {
+		p = hsvPalette
+	}
+
+	stops := make([]gradientStop, len(p.Stops))
+	for i, s := range p.Stops {
+		r, g, b := float64(s.R)/255, float64(s.G)/255, float64(s.B)/255
+		gs := gradientStop{pos: s.Pos, a: r, b: g, c: b}
+		if p.Space == api.ColorSpaceOKLab {
+			gs.a, gs.b, gs.c = srgbToOKLab(r, g, b)
+		}
+		stops[i] = gs
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].pos < stops[j].pos })
+
+	return &Gradient{stops: stops, space: p.Space}
+}
+
+// At returns sRGB color (components in 0..1) at position t.
+// t wraps around, so the gradient repeats every 1.0.
+func (g *Gradient) At(t float64) (r, gr, b float64) {
+	t -= math.Floor(t)
+
+	stops := g.stops
+	i := sort.Search(len(stops), func(i int) bool { return stops[i].pos > t })
+
+	var s gradientStop
+	switch {
+	case i == 0:
+		s = stops[0]
+	case i == len(stops):
+		s = stops[len(stops)-1]
+	default:
+		s0, s1 := stops[i-1], stops[i]
+		f := 0.0
+		if s1.pos > s0.pos {
+			f = (t - s0.pos) / (s1.pos - s0.pos)
+		}
+		s = gradientStop{
+			a: s0.a + (s1.a-s0.a)*f,
+			b: s0.b + (s1.b-s0.b)*f,
+			c: s0.c + (s1.c-s0.c)*f,
+		}
+	}
+
+	if g.space == api.ColorSpaceOKLab {
+		return okLabToSRGB(s.a, s.b, s.c)
+	}
+	return s.a, s.b, s.c
+}
+
+// srgbToOKLab converts sRGB (0..1) to OKLab
+func srgbToOKLab(r, g, b float64) (l, a, bb float64) {
+	r, g, b = srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)
+
+	lc := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	mc := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	sc := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+
+	return 0.2104542553*lc + 0.7936177850*mc - 0.0040720468*sc,
+		1.9779984951*lc - 2.4285922050*mc + 0.4505937099*sc,
+		0.0259040371*lc + 0.7827717662*mc - 0.8086757660*sc
+}
+
+// okLabToSRGB converts OKLab to sRGB (0..1), clamping out of gamut colors
+func okLabToSRGB(l, a, b float64) (r, g, bb float64) {
+	lc := l + 0.3963377774*a + 0.2158037573*b
+	mc := l - 0.1055613458*a - 0.0638541728*b
+	sc := l - 0.0894841775*a - 1.2914855480*b
+
+	lc, mc, sc = lc*lc*lc, mc*mc*mc, sc*sc*sc
+
+	r = 4.0767416621*lc - 3.3077115913*mc + 0.2309699292*sc
+	g = -1.2684380046*lc + 2.6097574011*mc - 0.3413193965*sc
+	bb = -0.0041960863*lc - 0.7034186147*mc + 1.7076147010*sc
+
+	return linearToSRGB(r), linearToSRGB(g), linearToSRGB(bb)
+}
+
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(c float64) float64 {
+	c = min(max(c, 0), 1)
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
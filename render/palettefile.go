@@ -0,0 +1,192 @@
+package render
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// LoadPaletteFile reads palettes from a .map or .ugr file.
+// .map file yields single palette named after the file.
+func LoadPaletteFile(path string) ([]api.Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".map":
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		p, err := ParseMapPalette(f, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return []api.Palette{p}, nil
+	case ".ugr":
+		ps, err := ParseUGRPalettes(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return ps, nil
+	default:
+		return nil, fmt.Errorf("unsupported palette file type %q", ext)
+	}
+}
+
+// ParseMapPalette parses Fractint style .map file.
+// Each line holds "R G B" triplet, anything after the third number is a comment.
+// Empty lines and lines starting with ';' or '#' are skipped.
+// Colors are spread evenly over the palette.
+func ParseMapPalette(r io.Reader, name string) (api.Palette, error) {
+	var colors [][3]uint8
+
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 {
+			return api.Palette{}, fmt.Errorf("line %d: expected 3 color components, got %d", lineNo, len(fields))
+		}
+		var c [3]uint8
+		for i := range c {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return api.Palette{}, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			c[i] = uint8(v)
+		}
+		colors = append(colors, c)
+	}
+	if err := sc.Err(); err != nil {
+		return api.Palette{}, err
+	}
+	if len(colors) == 0 {
+		return api.Palette{}, fmt.Errorf("no colors found")
+	}
+
+	p := api.Palette{Name: name, Stops: make([]api.GradientStop, len(colors))}
+	for i, c := range colors {
+		p.Stops[i] = api.GradientStop{Pos: float64(i) / float64(len(colors)), R: c[0], G: c[1], B: c[2]}
+	}
+	p.Stops = wrapStops(p.Stops)
+	return p, nil
+}
+
+// wrapStops adds copies of the last stop before 0 and of the first stop after 1,
+// so that the gradient interpolates smoothly across its cycle boundary.
+// stops must be sorted by position.
+func wrapStops(stops []api.GradientStop) []api.GradientStop {
+	first, last := stops[0], stops[len(stops)-1]
+	first.Pos += 1
+	last.Pos -= 1
+	return append(append([]api.GradientStop{last}, stops...), first)
+}
+
+// ugrIndexRange is the range of "index=" values in Ultra Fractal gradients
+const ugrIndexRange = 400
+
+// ParseUGRPalettes parses Ultra Fractal .ugr gradient file, which may contain multiple gradients:
+//
+//	name {
+//	gradient:
+//	  title="..." smooth=yes
+//	  index=0 color=8716288
+//	  ...
+//	}
+//
+// Colors are stored as decimal BGR integers.
+func ParseUGRPalettes(r io.Reader) ([]api.Palette, error) {
+	var palettes []api.Palette
+	var cur *api.Palette
+
+	sc := bufio.NewScanner(r)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasSuffix(line, "{"):
+			if cur != nil {
+				return nil, fmt.Errorf("line %d: nested gradient", lineNo)
+			}
+			cur = &api.Palette{Name: strings.TrimSpace(strings.TrimSuffix(line, "{"))}
+		case line == "}":
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: unexpected '}'", lineNo)
+			}
+			if len(cur.Stops) > 0 {
+				palettes = append(palettes, *cur)
+			}
+			cur = nil
+		case cur != nil:
+			stop, ok, err := parseUGRStop(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if ok {
+				cur.Stops = append(cur.Stops, stop)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("unterminated gradient %q", cur.Name)
+	}
+	if len(palettes) == 0 {
+		return nil, fmt.Errorf("no gradients found")
+	}
+
+	// ultra fractal gradients wrap around
+	for i := range palettes {
+		slices.SortStableFunc(palettes[i].Stops, func(a, b api.GradientStop) int { return cmp.Compare(a.Pos, b.Pos) })
+		palettes[i].Stops = wrapStops(palettes[i].Stops)
+	}
+	return palettes, nil
+}
+
+// parseUGRStop parses "index=N color=C" line. ok is false for lines without a color stop.
+func parseUGRStop(line string) (stop api.GradientStop, ok bool, err error) {
+	var index, color string
+	for _, f := range strings.Fields(line) {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "index":
+			index = v
+		case "color":
+			color = v
+		}
+	}
+	if index == "" || color == "" {
+		return api.GradientStop{}, false, nil
+	}
+
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return api.GradientStop{}, false, fmt.Errorf("index: %w", err)
+	}
+	c, err := strconv.ParseUint(color, 10, 32)
+	if err != nil {
+		return api.GradientStop{}, false, fmt.Errorf("color: %w", err)
+	}
+
+	return api.GradientStop{
+		Pos: float64(i) / ugrIndexRange,
+		R:   uint8(c),
+		G:   uint8(c >> 8),
+		B:   uint8(c >> 16),
+	}, true, nil
+}
@@ -0,0 +1,105 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+func TestParseMapPalette(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []api.GradientStop // without the wrapped stops
+		wantErr bool
+	}{
+		{
+			name: "colors",
+			file: "0 0 0\n255 128 1\n",
+			want: []api.GradientStop{{Pos: 0}, {Pos: 0.5, R: 255, G: 128, B: 1}},
+		},
+		{
+			name: "comments and empty lines",
+			file: "; exported by Fractint\n# another comment\n\n  0 0 0\n10 20 30 trailing comment\n",
+			want: []api.GradientStop{{Pos: 0}, {Pos: 0.5, R: 10, G: 20, B: 30}},
+		},
+		{name: "only comments", file: "; nothing\n", wantErr: true},
+		{name: "missing component", file: "0 0\n", wantErr: true},
+		{name: "component out of range", file: "0 0 256\n", wantErr: true},
+		{name: "not a number", file: "red green blue\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseMapPalette(strings.NewReader(tt.file), "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMapPalette() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if p.Name != "test" {
+				t.Errorf("name = %q, want %q", p.Name, "test")
+			}
+			if got := p.Stops[1 : len(p.Stops)-1]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stops = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUGRPalettes(t *testing.T) {
+	const twoGradients = `first {
+gradient:
+  title="first" smooth=yes
+  index=200 color=255
+  index=0 color=16711680
+}
+
+second {
+gradient:
+  index=100 color=65280
+}
+`
+	tests := []struct {
+		name    string
+		file    string
+		want    map[string][]api.GradientStop // without the wrapped stops
+		wantErr bool
+	}{
+		{
+			name: "two gradients",
+			file: twoGradients,
+			want: map[string][]api.GradientStop{
+				// colors are BGR, stops are sorted by index
+				"first":  {{Pos: 0, B: 255}, {Pos: 0.5, R: 255}},
+				"second": {{Pos: 0.25, G: 255}},
+			},
+		},
+		{name: "no gradients", file: "\n", wantErr: true},
+		{name: "unterminated", file: "first {\nindex=0 color=0\n", wantErr: true},
+		{name: "nested", file: "first {\nsecond {\n}\n}\n", wantErr: true},
+		{name: "unexpected brace", file: "}\n", wantErr: true},
+		{name: "bad color", file: "first {\nindex=0 color=blue\n}\n", wantErr: true},
+		{name: "bad index", file: "first {\nindex=x color=0\n}\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			palettes, err := ParseUGRPalettes(strings.NewReader(tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUGRPalettes() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make(map[string][]api.GradientStop, len(palettes))
+			for _, p := range palettes {
+				got[p.Name] = p.Stops[1 : len(p.Stops)-1]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("palettes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package render
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"math"
@@ -12,45 +13,79 @@ import (
 
 const maxIter = 1000
 
+// KernelVersion identifies the rendering code. Bump it whenever RenderTile output changes,
+// so that tiles cached by the server are not reused.
+const KernelVersion = 1
+
 var _ api.Renderer = RendererImpl{}
 
 type RendererImpl struct {
 	// callback on every tile render
 	OnTileRender func(tile image.Rectangle)
+	// callback on every density render
+	OnDensityRender func(seed uint64)
+	// NoSleep skips the artificial api.RenderTileSleepTime, e.g. for the server's reference renders
+	NoSleep bool
+}
+
+// Ping implements api.Renderer
+func (imp RendererImpl) Ping() error {
+	return nil
 }
 
-func (imp RendererImpl) RenderTile(r api.MandelRegion, imgW, imgH int, tile image.Rectangle) (*image.RGBA, error) {
+// RenderTile implements api.Renderer
+// ctx is checked between rows, so that cancelled tile is abandoned early.
+// (In the browser, rendering blocks the event loop, so cancellation is only received during RenderTileSleepTime.)
+func (imp RendererImpl) RenderTile(ctx context.Context, r api.MandelRegion, params api.RenderParams, imgW, imgH int, tile image.Rectangle) (*image.RGBA64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if imp.OnTileRender != nil {
 		imp.OnTileRender(tile)
 	}
 
 	// Image now has global coordinates (tile.Min .. tile.Max)
-	img := image.NewRGBA(tile)
+	img := image.NewRGBA64(tile)
+	trap := NewTrap(params.Trap)
+	gradient := NewGradient(params.Palette)
+	cycle := params.PaletteCycle
+	if cycle == 0 {
+		cycle = defaultPaletteCycle
+	}
 
 	for py := tile.Min.Y; py < tile.Max.Y; py++ {
-		yf := r.Ymin + (float64(py)/float64(imgH))*(r.Ymax-r.Ymin)
-
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		for pxg := tile.Min.X; pxg < tile.Max.X; pxg++ {
-			xf := r.Xmin + (float64(pxg)/float64(imgW))*(r.Xmax-r.Xmin)
-
-			c := complex(xf, yf)
+			c := PixelToC(r, params.Mapping, imgW, imgH, float64(pxg), float64(py))
 
-			mu, trap := MandelbrotOrbit(c, maxIter)
+			mu, trapDist := MandelbrotTrap(c, maxIter, trap)
 
-			var col color.RGBA
+			var col color.RGBA64
 			if mu >= float64(maxIter) {
-				col = color.RGBA{A: 255}
+				col = color.RGBA64{A: 0xffff}
 			} else {
-				tnorm := math.Exp(-5 * trap)
-				hue := math.Mod(mu*0.02+tnorm*0.3, 1.0)
-				col = hsv(hue, 1, 1)
+				t := mu/cycle + params.PaletteOffset
+				if trap != nil {
+					tnorm := math.Exp(-5 * trapDist)
+					t += tnorm * params.TrapWeight
+				}
+				r, g, b := gradient.At(t)
+				col = color.RGBA64{to16bit(r), to16bit(g), to16bit(b), 0xffff}
 			}
 
-			img.SetRGBA(pxg, py, col)
+			img.SetRGBA64(pxg, py, col)
 		}
 	}
 
-	time.Sleep(api.RenderTileSleepTime)
+	if !imp.NoSleep {
+		select {
+		case <-time.After(api.RenderTileSleepTime):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 
 	return img, nil
 }
@@ -69,44 +104,30 @@ func MandelbrotSmooth(c complex128, maxIter int) float64 {
 	return float64(maxIter)
 }
 
+// MandelbrotOrbit is MandelbrotTrap with a trap on the imaginary axis (Re=0).
 func MandelbrotOrbit(c complex128, maxIter int) (smooth float64, trap float64) {
-	z := complex(0, 0)
-	minTrap := math.MaxFloat64
-
-	for i := 0; i < maxIter; i++ {
-		z = z*z + c
-
-		// Example trap: distance to imaginary axis (Re=0)
-		d := math.Abs(real(z))
-		if d < minTrap {
-			minTrap = d
-		}
-
-		if real(z)*real(z)+imag(z)*imag(z) > 4 {
-			// Smooth escape
-			smooth = float64(i) + 1 - math.Log(math.Log(cmplx.Abs(z)))/math.Log(2)
-			return smooth, minTrap
-		}
-	}
-
-	// Inside the set
-	return float64(maxIter), minTrap
+	return MandelbrotTrap(c, maxIter, LineTrap{Angle: math.Pi / 2})
 }
 
 // Mandelbrot iteration with smooth coloring + circular orbit trap
 func MandelbrotCircleTrap(c complex128, maxIter int, R float64) (smooth float64, trap float64) {
+	return MandelbrotTrap(c, maxIter, CircleTrap{Radius: R})
+}
+
+// MandelbrotTrap iterates c, returning smooth iteration count
+// and minimal distance of the orbit to trap.
+// If trap is nil, returned trap distance is math.MaxFloat64.
+func MandelbrotTrap(c complex128, maxIter int, trap Trap) (smooth float64, trapDist float64) {
 	z := complex(0, 0)
 	minTrap := math.MaxFloat64
 
 	for i := range maxIter {
 		z = z*z + c
 
-		// -----------------------------------------
-		// Circular orbit trap: distance to |z| = R
-		// -----------------------------------------
-		d := math.Abs(cmplx.Abs(z) - R)
-		if d < minTrap {
-			minTrap = d
+		if trap != nil {
+			if d := trap.Distance(z); d < minTrap {
+				minTrap = d
+			}
 		}
 
 		// Escape check
@@ -120,29 +141,7 @@ func MandelbrotCircleTrap(c complex128, maxIter int, R float64) (smooth float64,
 	return float64(maxIter), minTrap
 }
 
-// Simple HSV → RGB
-func hsv(h, s, v float64) color.RGBA {
-	h = math.Mod(h, 1)
-	i := int(h * 6)
-	f := h*6 - float64(i)
-	p := v * (1 - s)
-	q := v * (1 - f*s)
-	t := v * (1 - (1-f)*s)
-
-	var r, g, b float64
-	switch i % 6 {
-	case 0:
-		r, g, b = v, t, p
-	case 1:
-		r, g, b = q, v, p
-	case 2:
-		r, g, b = p, v, t
-	case 3:
-		r, g, b = p, q, v
-	case 4:
-		r, g, b = t, p, v
-	case 5:
-		r, g, b = v, p, q
-	}
-	return color.RGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255}
+// to16bit converts color component in range 0..1 to 16 bits
+func to16bit(c float64) uint16 {
+	return uint16(math.Round(min(max(c, 0), 1) * 0xffff))
 }
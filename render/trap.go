@@ -0,0 +1,92 @@
+package render
+
+import (
+	"math"
+	"math/cmplx"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// Trap measures how close an orbit point gets to a trap shape.
+type Trap interface {
+	Distance(z complex128) float64
+}
+
+// PointTrap traps orbits near a single point.
+type PointTrap struct {
+	Center complex128
+}
+
+func (t PointTrap) Distance(z complex128) float64 {
+	return cmplx.Abs(z - t.Center)
+}
+
+// LineTrap traps orbits near a line going through Point at Angle (radians).
+type LineTrap struct {
+	Point complex128
+	Angle float64
+}
+
+func (t LineTrap) Distance(z complex128) float64 {
+	d := z - t.Point
+	sin, cos := math.Sincos(t.Angle)
+	// distance along the line's normal
+	return math.Abs(imag(d)*cos - real(d)*sin)
+}
+
+// CircleTrap traps orbits near the circle |z - Center| = Radius.
+type CircleTrap struct {
+	Center complex128
+	Radius float64
+}
+
+func (t CircleTrap) Distance(z complex128) float64 {
+	return math.Abs(cmplx.Abs(z-t.Center) - t.Radius)
+}
+
+// CrossTrap traps orbits near two perpendicular lines through Center, rotated by Angle.
+type CrossTrap struct {
+	Center complex128
+	Angle  float64
+}
+
+func (t CrossTrap) Distance(z complex128) float64 {
+	a := LineTrap{Point: t.Center, Angle: t.Angle}.Distance(z)
+	b := LineTrap{Point: t.Center, Angle: t.Angle + math.Pi/2}.Distance(z)
+	return math.Min(a, b)
+}
+
+// StalksTrap is Pickover's stalks trap: distance to the axes through Center, in units of Width.
+type StalksTrap struct {
+	Center complex128
+	Width  float64
+}
+
+func (t StalksTrap) Distance(z complex128) float64 {
+	d := z - t.Center
+	m := math.Min(math.Abs(real(d)), math.Abs(imag(d)))
+	if t.Width > 0 {
+		m /= t.Width
+	}
+	return m
+}
+
+// NewTrap returns Trap described by api.OrbitTrap.
+// Returns nil for api.TrapNone.
+func NewTrap(t api.OrbitTrap) Trap {
+	center := complex(t.X, t.Y)
+	switch t.Kind {
+	case api.TrapPoint:
+		return PointTrap{Center: center}
+	case api.TrapLine:
+		return LineTrap{Point: center, Angle: t.Angle}
+	case api.TrapCircle:
+		return CircleTrap{Center: center, Radius: t.Radius}
+	case api.TrapCross:
+		return CrossTrap{Center: center, Angle: t.Angle}
+	case api.TrapStalks:
+		return StalksTrap{Center: center, Width: t.Radius}
+	default:
+		return nil
+	}
+}
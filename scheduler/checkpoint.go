@@ -0,0 +1,435 @@
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+const (
+	checkpointStateFile = "job.json"
+	checkpointTilesFile = "tiles.log"
+)
+
+// checkpointState describes image job.
+// Its finished tiles are appended to the tiles log next to it, see tileRecord.
+type checkpointState struct {
+	W, H      int
+	TileSize  int
+	Region    api.MandelRegion
+	Params    api.RenderParams
+	StoreFile string `json:",omitempty"` // file of DiskTileStore, empty for MemTileStore
+}
+
+// tileRecord is the header of a record in the tiles log, followed by Size bytes of the tile's pixels.
+// Pixels are image.RGBA64.Pix of the tile compressed by flate. Tiles of DiskTileStore have no pixels, they are in the store's file.
+// Later records of a tile replace the earlier ones.
+type tileRecord struct {
+	MinX, MinY, MaxX, MaxY int32
+	Size                   uint32 // removedTile if the tile is rendered again, e.g. after its worker was rejected
+}
+
+const removedTile = math.MaxUint32
+
+// checkpointLog is the tiles log being appended to
+type checkpointLog struct {
+	f     *os.File
+	size  int64                      // length of complete records
+	saved map[image.Rectangle]uint64 // finished tiles in the log and workers that rendered them, see renderedBy
+}
+
+// CheckpointLoop saves job's progress to dir every interval, until the job is finished or ctx is done.
+// Only tiles finished since the last save are appended, so a save costs the same at any progress.
+// Finished job doesn't need resuming, so its checkpoint is removed.
+// Once ctx is done, progress is saved for the last time before returning, so that nothing is lost on shutdown.
+func (iws *ImgWorkScheduler) CheckpointLoop(ctx context.Context, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var cl *checkpointLog
+	save := func() {
+		// failure to save is only logged and tried again at the next tick
+		if cl == nil {
+			var err error
+			if cl, err = iws.startCheckpoint(dir); err != nil {
+				log.Printf("checkpoint: %v", err)
+				return
+			}
+		}
+		iws.appendCheckpoint(cl, dir)
+	}
+	defer func() {
+		if cl != nil {
+			cl.f.Close()
+		}
+	}()
+
+	save()
+	for {
+		select {
+		case <-iws.ctx.Done():
+			if cl != nil {
+				cl.f.Close()
+				cl = nil
+			}
+			removeCheckpoint(dir)
+			return
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
+
+// startCheckpoint writes job's state to dir and creates empty tiles log.
+// Tiles log of the previous checkpoint is removed first, so that it is never resumed as tiles of this job.
+func (iws *ImgWorkScheduler) startCheckpoint(dir string) (*checkpointLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	tilesFile := filepath.Join(dir, checkpointTilesFile)
+	if err := os.Remove(tilesFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("os.Remove: %w", err)
+	}
+
+	err := writeFileAtomic(filepath.Join(dir, checkpointStateFile), func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "\t")
+		return enc.Encode(iws.checkpointState())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("save state: %w", err)
+	}
+
+	f, err := os.OpenFile(tilesFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %w", err)
+	}
+	return &checkpointLog{f: f, saved: make(map[image.Rectangle]uint64)}, nil
+}
+
+// appendCheckpoint appends tiles finished since the last save to cl, and removes tiles that are rendered again.
+// Records are synced to disk, after the pixels of DiskTileStore are. failure to save is only logged
+func (iws *ImgWorkScheduler) appendCheckpoint(cl *checkpointLog, dir string) {
+	finished := iws.finishedBy()
+	var removed, added []image.Rectangle
+	for tile := range cl.saved {
+		if _, found := finished[tile]; !found {
+			removed = append(removed, tile)
+		}
+	}
+	for tile, id := range finished {
+		if savedID, found := cl.saved[tile]; !found || savedID != id {
+			added = append(added, tile)
+		}
+	}
+	if len(removed) == 0 && len(added) == 0 {
+		return
+	}
+
+	if err := iws.writeTileRecords(cl, removed, added); err != nil {
+		log.Printf("checkpoint: %v", err)
+		// drop the incomplete records, so that the next save appends to complete ones
+		if err := cl.f.Truncate(cl.size); err != nil {
+			log.Printf("checkpoint: f.Truncate: %v", err)
+		}
+		return
+	}
+	for _, tile := range removed {
+		delete(cl.saved, tile)
+	}
+	for _, tile := range added {
+		cl.saved[tile] = finished[tile]
+	}
+	log.Printf("checkpoint: %d/%d tiles saved to %q", len(cl.saved), iws.tilesCount, dir)
+}
+
+// writeTileRecords appends records of removed and added tiles to cl at cl.size and syncs them.
+// cl.size is moved past them only if all were written
+func (iws *ImgWorkScheduler) writeTileRecords(cl *checkpointLog, removed, added []image.Rectangle) error {
+	diskStore, onDisk := iws.store.(*DiskTileStore)
+	if onDisk && len(added) > 0 {
+		// records must not get to disk before the pixels they point to
+		if err := diskStore.sync(); err != nil {
+			return fmt.Errorf("store.sync: %w", err)
+		}
+	}
+
+	ow := io.NewOffsetWriter(cl.f, cl.size)
+	bw := bufio.NewWriter(ow)
+	for _, tile := range removed {
+		if err := writeTileRecord(bw, tile, removedTile, nil); err != nil {
+			return err
+		}
+	}
+	var pixels bytes.Buffer
+	for _, tile := range added {
+		pixels.Reset()
+		if !onDisk {
+			tileImg, err := iws.store.getTile(tile)
+			if err != nil {
+				return fmt.Errorf("store.getTile: %w", err)
+			}
+			fw, _ := flate.NewWriter(&pixels, flate.BestSpeed) // error is only returned for invalid level
+			if _, err := fw.Write(tileImg.Pix); err != nil {
+				return fmt.Errorf("flate: %w", err)
+			}
+			if err := fw.Close(); err != nil {
+				return fmt.Errorf("flate: %w", err)
+			}
+		}
+		if err := writeTileRecord(bw, tile, uint32(pixels.Len()), pixels.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write tiles log: %w", err)
+	}
+	if err := cl.f.Sync(); err != nil {
+		return fmt.Errorf("f.Sync: %w", err)
+	}
+	size, err := ow.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("Seek: %w", err)
+	}
+	cl.size += size
+	return nil
+}
+
+// writeTileRecord writes record of tile with size and pixels to w
+func writeTileRecord(w io.Writer, tile image.Rectangle, size uint32, pixels []byte) error {
+	rec := tileRecord{
+		MinX: int32(tile.Min.X), MinY: int32(tile.Min.Y),
+		MaxX: int32(tile.Max.X), MaxY: int32(tile.Max.Y),
+		Size: size,
+	}
+	if err := binary.Write(w, binary.LittleEndian, rec); err != nil {
+		return fmt.Errorf("write tiles log: %w", err)
+	}
+	if _, err := w.Write(pixels); err != nil {
+		return fmt.Errorf("write tiles log: %w", err)
+	}
+	return nil
+}
+
+// readTilesLog returns pixels of tiles in the tiles log read from r, see tileRecord.
+// Incomplete record at the end, left by a crash during a save, is ignored.
+func readTilesLog(r io.Reader) (map[image.Rectangle][]byte, error) {
+	tiles := make(map[image.Rectangle][]byte)
+	for {
+		var rec tileRecord
+		err := binary.Read(r, binary.LittleEndian, &rec)
+		if err == io.EOF {
+			return tiles, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Printf("checkpoint: incomplete tile record at the end of tiles log ignored")
+			return tiles, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("binary.Read: %w", err)
+		}
+
+		tile := image.Rect(int(rec.MinX), int(rec.MinY), int(rec.MaxX), int(rec.MaxY))
+		if rec.Size == removedTile {
+			delete(tiles, tile)
+			continue
+		}
+		// flate adds only a few bytes to pixels it can't compress
+		if tile.Empty() || int64(rec.Size) > int64(tile.Dx())*int64(tile.Dy())*8+1024 {
+			return nil, fmt.Errorf("invalid record of tile %s with %d bytes", tile, rec.Size)
+		}
+		pixels := make([]byte, rec.Size)
+		if _, err := io.ReadFull(r, pixels); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
+				log.Printf("checkpoint: incomplete tile record at the end of tiles log ignored")
+				return tiles, nil
+			}
+			return nil, fmt.Errorf("io.ReadFull: %w", err)
+		}
+		tiles[tile] = pixels
+	}
+}
+
+// checkpointState returns description of the job
+func (iws *ImgWorkScheduler) checkpointState() checkpointState {
+	state := checkpointState{
+		W:        iws.store.bounds().Dx(),
+		H:        iws.store.bounds().Dy(),
+		TileSize: iws.tileSize,
+		Region:   iws.mRegion,
+		Params:   iws.params,
+	}
+	if diskStore, onDisk := iws.store.(*DiskTileStore); onDisk {
+		state.StoreFile = diskStore.filename()
+	}
+	return state
+}
+
+// finishedBy returns finished tiles and workers that rendered them, see renderedBy
+func (iws *ImgWorkScheduler) finishedBy() map[image.Rectangle]uint64 {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	finished := make(map[image.Rectangle]uint64, len(iws.finishedTiles))
+	for tile := range iws.finishedTiles {
+		finished[tile] = iws.renderedBy[tile]
+	}
+	return finished
+}
+
+// writeFileAtomic writes filename through a temporary file,
+// so that a crash never leaves the file half written
+func writeFileAtomic(filename string, write func(f *os.File) error) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(f.Name()) // fails harmlessly after the rename
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("f.Close: %w", err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("os.Rename: %w", err)
+	}
+	return nil
+}
+
+// ResumeImgWorkScheduler recreates unfinished job checkpointed in dir, rendering up to maxCopies copies of a tile at once.
+// The job is resumed into the same kind of store it was rendered to. DiskTileStore is reopened with the pixels of its finished tiles.
+// returns nil job if there is no checkpoint
+func ResumeImgWorkScheduler(dir string, maxCopies int, cache *TileCache) (*ImgWorkScheduler, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointStateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	tiles := make(map[image.Rectangle][]byte)
+	f, err := os.Open(filepath.Join(dir, checkpointTilesFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// crash right after the state was saved, no tile is finished
+	case err != nil:
+		return nil, fmt.Errorf("os.Open: %w", err)
+	default:
+		tiles, err = readTilesLog(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read tiles log: %w", err)
+		}
+	}
+
+	if state.TileSize == 0 {
+		// checkpoints of older versions had no tile size
+		state.TileSize = DefaultTileSize
+	}
+	var store TileStore
+	if state.StoreFile != "" {
+		if store, err = OpenDiskTileStore(state.StoreFile, state.W, state.H); err != nil {
+			return nil, fmt.Errorf("OpenDiskTileStore: %w", err)
+		}
+	} else {
+		store = NewMemTileStore(state.W, state.H)
+	}
+	iws := NewImgWorkScheduler(store, state.Region, state.Params, state.TileSize, maxCopies, cache)
+	restored := 0
+	for tile, pixels := range tiles {
+		iws.m.Lock()
+		_, unstarted := iws.unstartedTiles[tile]
+		if unstarted {
+			delete(iws.unstartedTiles, tile)
+			iws.inProcessTiles[tile] = struct{}{}
+		}
+		iws.m.Unlock()
+		if !unstarted {
+			// loaded from the tile cache or not a tile of this job at all
+			continue
+		}
+
+		tileImg, err := restoreTile(store, tile, pixels)
+		if err == nil {
+			_, err = iws.mergeTile(tileImg, 0)
+		}
+		if err != nil {
+			if diskStore, onDisk := store.(*DiskTileStore); onDisk {
+				diskStore.Close()
+			}
+			return nil, fmt.Errorf("restore tile %s: %w", tile, err)
+		}
+		restored++
+	}
+
+	log.Printf("checkpoint: resumed %dx%d job from %q, %d tiles restored", state.W, state.H, dir, restored)
+	return iws, nil
+}
+
+// restoreTile returns image of tile from its pixels in the tiles log, or from DiskTileStore if it has none
+func restoreTile(store TileStore, tile image.Rectangle, pixels []byte) (*image.RGBA64, error) {
+	if len(pixels) == 0 {
+		if _, onDisk := store.(*DiskTileStore); !onDisk {
+			return nil, errors.New("no pixels in tiles log")
+		}
+		return store.getTile(tile)
+	}
+
+	tileImg := image.NewRGBA64(tile)
+	fr := flate.NewReader(bytes.NewReader(pixels))
+	defer fr.Close()
+	if _, err := io.ReadFull(fr, tileImg.Pix); err != nil {
+		return nil, fmt.Errorf("flate: %w", err)
+	}
+	return tileImg, nil
+}
+
+// IsJob reports whether iws renders w x h image of region with params, split into tiles of tileSize, into DiskTileStore in storeFile
+// (empty for MemTileStore). Resumed job is compared with the configured one this way, so that a checkpoint doesn't silently replace it.
+func (iws *ImgWorkScheduler) IsJob(w, h int, region api.MandelRegion, params api.RenderParams, tileSize int, storeFile string) bool {
+	// compared as json, which is what the checkpoint stores, so that e.g. nil and empty palette stops are equal
+	got, err := json.Marshal(iws.checkpointState())
+	if err != nil {
+		return false
+	}
+	want, err := json.Marshal(checkpointState{W: w, H: h, TileSize: tileSize, Region: region, Params: params, StoreFile: storeFile})
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(got, want)
+}
+
+// removeCheckpoint deletes checkpoint files from dir
+func removeCheckpoint(dir string) {
+	for _, name := range []string{checkpointStateFile, checkpointTilesFile} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("checkpoint: %v", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"image"
+	"image/color"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	const w, h, tileSize = 100, 70, 32
+	stores := map[string]func(t *testing.T) TileStore{
+		"mem": func(t *testing.T) TileStore { return NewMemTileStore(w, h) },
+		"disk": func(t *testing.T) TileStore {
+			store, err := NewDiskTileStore(filepath.Join(t.TempDir(), "img.raw"), w, h)
+			if err != nil {
+				t.Fatalf("NewDiskTileStore: %v", err)
+			}
+			return store
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store := newStore(t)
+			if diskStore, onDisk := store.(*DiskTileStore); onDisk {
+				defer diskStore.Close()
+			}
+			job := NewImgWorkScheduler(store, api.FullSet, api.DefaultRenderParams, tileSize, 1, nil)
+
+			// mergeNext merges next tile as rendered by worker id, filled with color of id
+			mergeNext := func(id uint64) {
+				tile, found := job.PopUnstartedTile()
+				if !found {
+					t.Fatal("no unstarted tile")
+				}
+				tileImg := image.NewRGBA64(tile)
+				for y := tile.Min.Y; y < tile.Max.Y; y++ {
+					for x := tile.Min.X; x < tile.Max.X; x++ {
+						tileImg.SetRGBA64(x, y, color.RGBA64{R: uint16(x), G: uint16(y), B: uint16(id), A: 0xffff})
+					}
+				}
+				if _, err := job.mergeTile(tileImg, id); err != nil {
+					t.Fatalf("mergeTile: %v", err)
+				}
+			}
+
+			cl, err := job.startCheckpoint(dir)
+			if err != nil {
+				t.Fatalf("startCheckpoint: %v", err)
+			}
+			defer cl.f.Close()
+			mergeNext(1)
+			mergeNext(2)
+			job.appendCheckpoint(cl, dir)
+			// tiles of the rejected worker are removed from the checkpoint
+			job.RejectWorker(2)
+			mergeNext(3)
+			job.appendCheckpoint(cl, dir)
+			// incomplete record of a crash during a save
+			if _, err := cl.f.WriteAt([]byte{1, 2, 3}, cl.size); err != nil {
+				t.Fatalf("WriteAt: %v", err)
+			}
+
+			resumed, err := ResumeImgWorkScheduler(dir, 1, nil)
+			if err != nil {
+				t.Fatalf("ResumeImgWorkScheduler: %v", err)
+			}
+			if resumed == nil {
+				t.Fatal("no job resumed")
+			}
+			if !resumed.IsJob(w, h, api.FullSet, api.DefaultRenderParams, tileSize, job.checkpointState().StoreFile) {
+				t.Errorf("resumed job is %+v", resumed.checkpointState())
+			}
+			if diskStore, onDisk := resumed.store.(*DiskTileStore); onDisk {
+				defer diskStore.Close()
+			}
+			if _, isMem := resumed.store.(*MemTileStore); isMem != (name == "mem") {
+				t.Errorf("resumed into %T", resumed.store)
+			}
+			want, _ := job.FinishedTiles()
+			got, _ := resumed.FinishedTiles()
+			if !maps.Equal(got, want) || len(got) != 2 {
+				t.Fatalf("resumed tiles %v, want %v", got, want)
+			}
+			for tile := range got {
+				wantImg, _ := job.store.getTile(tile)
+				gotImg, err := resumed.store.getTile(tile)
+				if err != nil {
+					t.Fatalf("getTile: %v", err)
+				}
+				if string(gotImg.Pix) != string(wantImg.Pix) {
+					t.Errorf("pixels of tile %s differ", tile)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckpointRemovedWhenFinished(t *testing.T) {
+	dir := t.TempDir()
+	job := NewImgWorkScheduler(NewMemTileStore(10, 10), api.FullSet, api.DefaultRenderParams, 10, 1, nil)
+	cl, err := job.startCheckpoint(dir)
+	if err != nil {
+		t.Fatalf("startCheckpoint: %v", err)
+	}
+	cl.f.Close()
+
+	job.Cancel()
+	job.CheckpointLoop(t.Context(), dir, time.Hour)
+	for _, name := range []string{checkpointStateFile, checkpointTilesFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", name, err)
+		}
+	}
+}
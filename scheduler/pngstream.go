@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/marben/irpc_dist_mandel/pngstream"
+)
+
+// pngStreamBand is the number of rows read from the store at once
+const pngStreamBand = 64
+
+// encodePNGStream writes image in store to w as 16 bit RGBA png.
+// Image is read from the store in bands of rows, so it never has to fit into memory.
+func encodePNGStream(w io.Writer, store TileStore) error {
+	b := store.bounds()
+	pw, err := pngstream.NewWriter(w, b.Dx(), b.Dy())
+	if err != nil {
+		return fmt.Errorf("pngstream.NewWriter: %w", err)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y += pngStreamBand {
+		band, err := store.getTile(image.Rect(b.Min.X, y, b.Max.X, min(y+pngStreamBand, b.Max.Y)))
+		if err != nil {
+			return fmt.Errorf("store.getTile: %w", err)
+		}
+		if err := pw.WriteRows(band); err != nil {
+			return fmt.Errorf("pw.WriteRows: %w", err)
+		}
+	}
+	return pw.Close()
+}
+
+// savePNGStream saves image in store to filename using encodePNGStream
+func savePNGStream(filename string, store TileStore) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("os.Create: %w", err)
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	if err := encodePNGStream(bw, store); err != nil {
+		return fmt.Errorf("encodePNGStream: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("bw.Flush: %w", err)
+	}
+	return f.Close()
+}
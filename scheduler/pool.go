@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// WorkUnit is a piece of work done with a single renderer
+// ctx is done once the worker is removed, e.g. when it disconnects
+// returned error means the renderer is not usable anymore
+type WorkUnit func(ctx context.Context, renderer api.Renderer) error
+
+// WorkSource hands out work to the workers of WorkPool
+type WorkSource interface {
+	// PopWork returns next unit of work. found is false if there is nothing to do at the moment.
+	PopWork() (work WorkUnit, found bool)
+}
+
+// WorkerRejecter is implemented by work sources (and others, see WorkPool.AddRejecter) able to roll back results
+// of a worker once it returned a bad result (see ErrBadResult), so that its earlier tiles are not trusted either.
+type WorkerRejecter interface {
+	// RejectWorker drops results of worker id (see WorkerID)
+	RejectWorker(id uint64)
+}
+
+// ErrPoolStopped is returned by AddRenderer once the pool is stopped
+var ErrPoolStopped = errors.New("work pool stopped")
+
+// WorkPool shares connected renderers (workers) among all work sources.
+// Sources are asked for work in the order they were added, so earlier sources have priority.
+// Idle workers wait until some source notifies the pool about new work.
+type WorkPool struct {
+	sources      []WorkSource
+	rejecters    []WorkerRejecter // besides the sources
+	verification *Verification    // nil disables checks of workers' tiles
+	workersCount int
+	badWorkers   int // workers dropped for bad tiles (see ErrBadResult)
+	lastWorkerID uint64
+	wake         chan struct{} // closed and replaced on Notify()
+	stopped      bool
+	inFlight     sync.WaitGroup // work units being done
+	m            sync.Mutex
+}
+
+// NewWorkPool creates pool spot checking tiles of its workers as given by verification. nil disables the checks.
+func NewWorkPool(verification *Verification) *WorkPool {
+	return &WorkPool{wake: make(chan struct{}), verification: verification}
+}
+
+// AddSource adds work source with lower priority than already added sources
+func (wp *WorkPool) AddSource(s WorkSource) {
+	wp.m.Lock()
+	wp.sources = append(wp.sources, s)
+	wp.m.Unlock()
+
+	wp.Notify()
+}
+
+// AddRejecter adds r to be told about workers dropped for bad results, besides the sources implementing WorkerRejecter.
+// E.g. TileCache shared by all jobs, which may not be sources anymore.
+func (wp *WorkPool) AddRejecter(r WorkerRejecter) {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	wp.rejecters = append(wp.rejecters, r)
+}
+
+// RemoveSource removes s from sources
+func (wp *WorkPool) RemoveSource(s WorkSource) {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	// PopWork iterates sources without the lock, so the slice is replaced rather than modified
+	wp.sources = slices.DeleteFunc(slices.Clone(wp.sources), func(src WorkSource) bool { return src == s })
+}
+
+// Notify wakes idle workers to look for new work
+func (wp *WorkPool) Notify() {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	close(wp.wake)
+	wp.wake = make(chan struct{})
+}
+
+// AddRenderer uses renderer as a worker until ctx is done, the renderer fails or the pool is stopped
+// can be called from multiple goroutines in parallel. renderers then share the work
+// Returned error wraps ErrBadResult if the renderer failed verification.
+func (wp *WorkPool) AddRenderer(ctx context.Context, renderer api.Renderer) error {
+	w := &worker{Renderer: renderer, id: wp.incActiveWorkers(), verification: wp.verification}
+	defer wp.decActiveWorkers()
+
+	for {
+		work, wake, err := wp.popWork()
+		if err != nil {
+			return err
+		}
+		if work == nil {
+			select {
+			case <-wake:
+				continue
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			}
+		}
+		err = work(ctx, w)
+		wp.inFlight.Done()
+		// idle workers may find work now, e.g. a tile that had the maximum of copies rendered
+		wp.Notify()
+		if errors.Is(err, ErrBadResult) {
+			wp.countBadWorker()
+			wp.rejectWorker(w.id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// popWork returns work of the first source that has some. Returned work is counted in wp.inFlight
+// if there is no work, returned channel is closed once there might be
+func (wp *WorkPool) popWork() (WorkUnit, <-chan struct{}, error) {
+	wp.m.Lock()
+	if wp.stopped {
+		wp.m.Unlock()
+		return nil, nil, ErrPoolStopped
+	}
+	sources := wp.sources
+	wake := wp.wake
+	// added under the lock, so that Stop doesn't miss it
+	wp.inFlight.Add(1)
+	wp.m.Unlock()
+
+	for _, s := range sources {
+		if work, found := s.PopWork(); found {
+			return work, wake, nil
+		}
+	}
+	wp.inFlight.Done()
+	return nil, wake, nil
+}
+
+// Stop stops handing out work. Workers return ErrPoolStopped once they finish the work they are doing.
+// Stop waits for the work in progress until ctx is done.
+func (wp *WorkPool) Stop(ctx context.Context) error {
+	wp.m.Lock()
+	wp.stopped = true
+	wp.m.Unlock()
+	// idle workers wake up to find out the pool is stopped
+	wp.Notify()
+
+	done := make(chan struct{})
+	go func() {
+		wp.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// WorkersCount returns the number of connected workers
+func (wp *WorkPool) WorkersCount() (int, error) {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	return wp.workersCount, nil
+}
+
+// incActiveWorkers counts new worker and returns its id
+func (wp *WorkPool) incActiveWorkers() uint64 {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	wp.workersCount++
+	wp.lastWorkerID++
+
+	log.Printf("workers: %d", wp.workersCount)
+	return wp.lastWorkerID
+}
+
+// rejectWorker rolls back results of worker id in all sources and rejecters
+func (wp *WorkPool) rejectWorker(id uint64) {
+	wp.m.Lock()
+	sources := wp.sources
+	rejecters := slices.Clone(wp.rejecters)
+	wp.m.Unlock()
+
+	for _, s := range sources {
+		if r, ok := s.(WorkerRejecter); ok {
+			r.RejectWorker(id)
+		}
+	}
+	for _, r := range rejecters {
+		r.RejectWorker(id)
+	}
+	// rejected tiles are handed out again
+	wp.Notify()
+}
+
+func (wp *WorkPool) countBadWorker() {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	wp.badWorkers++
+
+	log.Printf("workers dropped for bad tiles: %d", wp.badWorkers)
+}
+
+func (wp *WorkPool) decActiveWorkers() {
+	wp.m.Lock()
+	defer wp.m.Unlock()
+
+	wp.workersCount--
+
+	log.Printf("workers: %d", wp.workersCount)
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+)
+
+// TestWorkPoolRendersSameImage renders an image split into tiles by several workers of a pool
+// and compares it with the same image rendered by a single RenderTile call.
+func TestWorkPoolRendersSameImage(t *testing.T) {
+	const w, h = 200, 150 // not a multiple of the tile size, so that border tiles are clipped
+	region := api.SeahorseValley
+	params := api.DefaultRenderParams
+	renderer := render.RendererImpl{NoSleep: true}
+
+	job := NewImgWorkScheduler(NewMemTileStore(w, h), region, params, 64, DefaultMaxTileCopies, nil)
+	// every tile is checked against the reference, which is the same renderer, so no tile may be rejected
+	pool := NewWorkPool(&Verification{Rate: 1, Reference: renderer})
+	pool.AddSource(job)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.AddRenderer(ctx, renderer); err != nil && ctx.Err() == nil {
+				t.Errorf("worker %d: %v", i, err)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	select {
+	case <-job.Done():
+	case <-time.After(time.Minute):
+		t.Fatal("job not finished in time")
+	}
+	got, err := job.GetImage()
+	if err != nil {
+		t.Fatalf("job.GetImage: %v", err)
+	}
+
+	want, err := renderer.RenderTile(context.Background(), region, params, w, h, image.Rect(0, 0, w, h))
+	if err != nil {
+		t.Fatalf("RenderTile: %v", err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("image bounds %s, want %s", got.Bounds(), want.Bounds())
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if g, w := got.RGBA64At(x, y), want.RGBA64At(x, y); g != w {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+
+	if stats := job.Stats(); stats.Renders < job.tilesCount {
+		t.Errorf("%d tile renders, want at least %d tiles", stats.Renders, job.tilesCount)
+	}
+}
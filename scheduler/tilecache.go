@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+)
+
+// TileCache is a content addressed on-disk cache of rendered tiles.
+// Key is a hash of everything that affects the tile's pixels, value is 16 bit png of the tile.
+// Once the cache grows over maxBytes, least recently used tiles are evicted.
+// Access order survives restarts through file modification times.
+type TileCache struct {
+	dir      string
+	maxBytes int64
+
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List // front is the most recently used
+	m       sync.Mutex
+}
+
+type tileCacheEntry struct {
+	key    string
+	size   int64
+	worker uint64 // id of the worker that rendered the tile (see WorkerID), 0 if unknown
+}
+
+// OpenTileCache opens cache in dir, creating dir if needed
+func OpenTileCache(dir string, maxBytes int64) (*TileCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	type file struct {
+		key   string
+		size  int64
+		mtime time.Time
+	}
+	var files []file
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.Contains(d.Name(), ".tmp") {
+			// temporary file of writeFileAtomic, left by a crash during put
+			if err := os.Remove(path); err != nil {
+				log.Printf("tile cache: %v", err)
+			}
+			return nil
+		}
+		if d.IsDir() || filepath.Ext(path) != ".png" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key := filepath.Base(path[:len(path)-len(".png")])
+		files = append(files, file{key: key, size: info.Size(), mtime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("filepath.WalkDir: %w", err)
+	}
+
+	// most recently used first
+	slices.SortFunc(files, func(a, b file) int { return b.mtime.Compare(a.mtime) })
+
+	c := &TileCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element, len(files)),
+		lru:      list.New(),
+	}
+	for _, f := range files {
+		c.entries[f.key] = c.lru.PushBack(&tileCacheEntry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+	c.m.Lock()
+	c.evict()
+	c.m.Unlock()
+
+	log.Printf("tile cache %q: %d tiles, %d MB", dir, len(c.entries), c.size>>20)
+	return c, nil
+}
+
+// tileCacheKey returns key of tile rendered with given parameters
+// render.KernelVersion is part of the key, so changes of rendering code invalidate the cache
+// Region or params with NaN or infinite numbers have no key.
+func tileCacheKey(reg api.MandelRegion, params api.RenderParams, imgW, imgH int, tile image.Rectangle) (string, error) {
+	data, err := json.Marshal(struct {
+		Kernel     int
+		Region     api.MandelRegion
+		Params     api.RenderParams
+		ImgW, ImgH int
+		Tile       image.Rectangle
+	}{render.KernelVersion, reg, params, imgW, imgH, tile})
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// path of the key's file. Files are spread into subdirectories by the key prefix.
+func (c *TileCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".png")
+}
+
+// get returns cached tile of given rect
+// The file is read without holding c.m, so the entry may be removed or put again meanwhile.
+// The tile is returned only if the entry is still the one it was read for, otherwise
+// it might be a tile of a rejected worker (see RejectWorker).
+func (c *TileCache) get(key string, rect image.Rectangle) (*image.RGBA64, bool) {
+	c.m.Lock()
+	e, found := c.entries[key]
+	if found {
+		c.lru.MoveToFront(e)
+	}
+	c.m.Unlock()
+	if !found {
+		return nil, false
+	}
+
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("tile cache: %v", err)
+		c.removeIfSame(key, e)
+		return nil, false
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Size() != rect.Size() {
+		log.Printf("tile cache: corrupted tile %q: %v", path, err)
+		c.removeIfSame(key, e)
+		return nil, false
+	}
+
+	c.m.Lock()
+	same := c.entries[key] == e
+	c.m.Unlock()
+	if !same {
+		return nil, false
+	}
+
+	// keep the access order for the next start
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	tileImg := image.NewRGBA64(rect)
+	draw.Draw(tileImg, rect, img, img.Bounds().Min, draw.Src)
+	return tileImg, true
+}
+
+// put stores tile rendered by worker under key
+func (c *TileCache) put(key string, tileImg *image.RGBA64, worker uint64) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, tileImg); err != nil {
+		return fmt.Errorf("png.Encode: %w", err)
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+	// write to temporary file first, so that nobody reads half written tile.
+	// Each put has its own file, as the same tile may be put by several workers at once
+	err := writeFileAtomic(path, func(f *os.File) error {
+		if err := f.Chmod(0o644); err != nil {
+			return fmt.Errorf("f.Chmod: %w", err)
+		}
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("f.Write: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if e, found := c.entries[key]; found {
+		c.size -= e.Value.(*tileCacheEntry).size
+		c.lru.Remove(e)
+	}
+	size := int64(buf.Len())
+	c.entries[key] = c.lru.PushFront(&tileCacheEntry{key: key, size: size, worker: worker})
+	c.size += size
+	c.evict()
+
+	return nil
+}
+
+// removeIfSame drops key from the cache, unless its entry e was replaced or removed meanwhile
+func (c *TileCache) removeIfSame(key string, e *list.Element) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.entries[key] == e {
+		c.removeElement(e)
+	}
+}
+
+// RejectWorker implements WorkerRejecter. It removes tiles rendered by worker id, whichever job they belong to.
+// Workers are known only since the start, tiles of earlier runs are kept.
+func (c *TileCache) RejectWorker(id uint64) {
+	if id == 0 {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	removed := 0
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*tileCacheEntry).worker == id {
+			c.removeElement(e)
+			removed++
+		}
+		e = next
+	}
+	if removed > 0 {
+		log.Printf("tile cache: %d tiles of rejected worker removed", removed)
+	}
+}
+
+// evict removes least recently used tiles until the cache fits into maxBytes
+// c.m must be held
+func (c *TileCache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement removes entry from the cache and its file from disk
+// c.m must be held
+func (c *TileCache) removeElement(e *list.Element) {
+	entry := e.Value.(*tileCacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	if err := os.Remove(c.path(entry.key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("tile cache: %v", err)
+	}
+}
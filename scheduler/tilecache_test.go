@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	api "github.com/marben/irpc_dist_mandel"
+	"github.com/marben/irpc_dist_mandel/render"
+)
+
+// TestPopWorkMergesCachedTiles starts two jobs of the same image before any tile is cached.
+// Once the first one is rendered, the second one takes all its tiles from the cache instead of handing them out.
+func TestPopWorkMergesCachedTiles(t *testing.T) {
+	const w, h = 100, 70
+	cache, err := OpenTileCache(t.TempDir(), 1<<30)
+	if err != nil {
+		t.Fatalf("OpenTileCache: %v", err)
+	}
+	renderer := render.RendererImpl{NoSleep: true}
+	first := NewImgWorkScheduler(NewMemTileStore(w, h), api.SeahorseValley, api.DefaultRenderParams, 32, DefaultMaxTileCopies, cache)
+	second := NewImgWorkScheduler(NewMemTileStore(w, h), api.SeahorseValley, api.DefaultRenderParams, 32, DefaultMaxTileCopies, cache)
+
+	for {
+		work, found := first.PopWork()
+		if !found {
+			break
+		}
+		if err := work(context.Background(), renderer); err != nil {
+			t.Fatalf("render: %v", err)
+		}
+	}
+
+	if _, found := second.PopWork(); found {
+		t.Fatal("cached tile handed out")
+	}
+	select {
+	case <-second.Done():
+	default:
+		t.Fatal("job of cached tiles not finished")
+	}
+	want, err := first.GetImage()
+	if err != nil {
+		t.Fatalf("first.GetImage: %v", err)
+	}
+	got, err := second.GetImage()
+	if err != nil {
+		t.Fatalf("second.GetImage: %v", err)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if g, w := got.RGBA64At(x, y), want.RGBA64At(x, y); g != w {
+				t.Fatalf("pixel %d,%d is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+// TestCacheRemoveIfSame checks that a failed read of a tile removes only the entry it read,
+// not the same key put again meanwhile, and that tiles of rejected workers are not returned.
+func TestCacheRemoveIfSame(t *testing.T) {
+	cache, err := OpenTileCache(t.TempDir(), 1<<30)
+	if err != nil {
+		t.Fatalf("OpenTileCache: %v", err)
+	}
+	renderer := render.RendererImpl{NoSleep: true}
+	tile := image.Rect(0, 0, 32, 32)
+	tileImg, err := renderer.RenderTile(context.Background(), api.SeahorseValley, api.DefaultRenderParams, 32, 32, tile)
+	if err != nil {
+		t.Fatalf("RenderTile: %v", err)
+	}
+	const key = "0123456789abcdef"
+	if err := cache.put(key, tileImg, 1); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, found := cache.get(key, tile); !found {
+		t.Fatal("cached tile not found")
+	}
+
+	// entry of the read is replaced by a put of another worker, the new entry has to be kept
+	cache.m.Lock()
+	e := cache.entries[key]
+	cache.m.Unlock()
+	if err := cache.put(key, tileImg, 2); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	cache.removeIfSame(key, e)
+	if _, found := cache.get(key, tile); !found {
+		t.Fatal("tile put again removed by a stale entry")
+	}
+
+	cache.RejectWorker(2)
+	if _, found := cache.get(key, tile); found {
+		t.Fatal("tile of rejected worker returned")
+	}
+}
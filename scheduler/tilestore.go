@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"sync"
+)
+
+// TileStore holds pixels of an image being rendered, 16 bits per channel.
+// Implementations are safe for concurrent use.
+type TileStore interface {
+	// bounds of the whole image. Min is always 0,0.
+	bounds() image.Rectangle
+	// putTile writes tileImg at its bounds
+	putTile(tileImg *image.RGBA64) error
+	// getTile returns copy of rect part of the image. Returned image has the same bounds as rect.
+	getTile(rect image.Rectangle) (*image.RGBA64, error)
+}
+
+var (
+	_ TileStore = &MemTileStore{}
+	_ TileStore = &DiskTileStore{}
+)
+
+// MemTileStore keeps the whole image in memory
+type MemTileStore struct {
+	img *image.RGBA64
+	m   sync.RWMutex
+}
+
+func NewMemTileStore(w, h int) *MemTileStore {
+	return &MemTileStore{img: image.NewRGBA64(image.Rect(0, 0, w, h))}
+}
+
+func (s *MemTileStore) bounds() image.Rectangle {
+	return s.img.Rect
+}
+
+func (s *MemTileStore) putTile(tileImg *image.RGBA64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	draw.Draw(s.img, tileImg.Rect, tileImg, tileImg.Rect.Min, draw.Src)
+	return nil
+}
+
+func (s *MemTileStore) getTile(rect image.Rectangle) (*image.RGBA64, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	tileImg := image.NewRGBA64(rect)
+	draw.Draw(tileImg, rect, s.img, rect.Min, draw.Src)
+	return tileImg, nil
+}
+
+// DiskTileStore keeps the image in a file of raw pixel rows, in the layout of image.RGBA64.Pix.
+// Only rows of the tiles being read or written are in memory, so the image size is limited by disk space.
+// The file is sparse until the tiles are written, unwritten pixels read as transparent black.
+type DiskTileStore struct {
+	f    *os.File
+	rect image.Rectangle
+}
+
+// NewDiskTileStore creates w×h image store in filename. Existing file is overwritten.
+func NewDiskTileStore(filename string, w, h int) (*DiskTileStore, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %w", err)
+	}
+	if err := f.Truncate(int64(w) * int64(h) * 8); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("f.Truncate: %w", err)
+	}
+	return &DiskTileStore{f: f, rect: image.Rect(0, 0, w, h)}, nil
+}
+
+// OpenDiskTileStore opens w×h image store created by NewDiskTileStore in filename, keeping its pixels.
+// It is used to resume jobs, see ResumeImgWorkScheduler.
+func OpenDiskTileStore(filename string, w, h int) (*DiskTileStore, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("f.Stat: %w", err)
+	}
+	if size := int64(w) * int64(h) * 8; fi.Size() != size {
+		f.Close()
+		return nil, fmt.Errorf("%q has %d bytes, %dx%d image has %d", filename, fi.Size(), w, h, size)
+	}
+	return &DiskTileStore{f: f, rect: image.Rect(0, 0, w, h)}, nil
+}
+
+// Close closes the file. The store can't be used afterwards.
+func (s *DiskTileStore) Close() error {
+	return s.f.Close()
+}
+
+// filename of the store, as it was given to NewDiskTileStore or OpenDiskTileStore
+func (s *DiskTileStore) filename() string {
+	return s.f.Name()
+}
+
+// sync commits written tiles to disk
+func (s *DiskTileStore) sync() error {
+	return s.f.Sync()
+}
+
+func (s *DiskTileStore) bounds() image.Rectangle {
+	return s.rect
+}
+
+// offset returns file offset of pixel x, y
+func (s *DiskTileStore) offset(x, y int) int64 {
+	return (int64(y)*int64(s.rect.Dx()) + int64(x)) * 8
+}
+
+func (s *DiskTileStore) putTile(tileImg *image.RGBA64) error {
+	rect := tileImg.Rect.Intersect(s.rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := tileImg.Pix[tileImg.PixOffset(rect.Min.X, y):tileImg.PixOffset(rect.Max.X, y)]
+		if _, err := s.f.WriteAt(row, s.offset(rect.Min.X, y)); err != nil {
+			return fmt.Errorf("f.WriteAt: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *DiskTileStore) getTile(rect image.Rectangle) (*image.RGBA64, error) {
+	tileImg := image.NewRGBA64(rect)
+	rect = rect.Intersect(s.rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := tileImg.Pix[tileImg.PixOffset(rect.Min.X, y):tileImg.PixOffset(rect.Max.X, y)]
+		if _, err := s.f.ReadAt(row, s.offset(rect.Min.X, y)); err != nil {
+			return nil, fmt.Errorf("f.ReadAt: %w", err)
+		}
+	}
+	return tileImg, nil
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+func TestDiskTileStore(t *testing.T) {
+	store, err := NewDiskTileStore(filepath.Join(t.TempDir(), "img.raw"), 100, 70)
+	if err != nil {
+		t.Fatalf("NewDiskTileStore: %v", err)
+	}
+	defer store.Close()
+
+	// border tile reaches over the image, as tiles of SplitRectNoClip do
+	tiles := []image.Rectangle{image.Rect(0, 0, 64, 64), image.Rect(64, 64, 128, 128)}
+	for i, tile := range tiles {
+		tileImg := image.NewRGBA64(tile)
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			for x := tile.Min.X; x < tile.Max.X; x++ {
+				tileImg.SetRGBA64(x, y, color.RGBA64{R: uint16(x), G: uint16(y), B: uint16(i), A: 0xffff})
+			}
+		}
+		if err := store.putTile(tileImg); err != nil {
+			t.Fatalf("putTile(%s): %v", tile, err)
+		}
+	}
+
+	// rect across both tiles and unwritten pixels
+	rect := image.Rect(50, 50, 80, 70)
+	got, err := store.getTile(rect)
+	if err != nil {
+		t.Fatalf("getTile: %v", err)
+	}
+	if got.Rect != rect {
+		t.Fatalf("getTile bounds %s, want %s", got.Rect, rect)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			var want color.RGBA64 // unwritten pixels are transparent
+			switch p := image.Pt(x, y); {
+			case p.In(tiles[0]):
+				want = color.RGBA64{R: uint16(x), G: uint16(y), B: 0, A: 0xffff}
+			case p.In(tiles[1]):
+				want = color.RGBA64{R: uint16(x), G: uint16(y), B: 1, A: 0xffff}
+			}
+			if c := got.RGBA64At(x, y); c != want {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, c, want)
+			}
+		}
+	}
+}
+
+func TestGetImageOfDiskStore(t *testing.T) {
+	store, err := NewDiskTileStore(filepath.Join(t.TempDir(), "img.raw"), 64, 64)
+	if err != nil {
+		t.Fatalf("NewDiskTileStore: %v", err)
+	}
+	defer store.Close()
+
+	job := NewImgWorkScheduler(store, api.FullSet, api.DefaultRenderParams, 64, DefaultMaxTileCopies, nil)
+	if _, err := job.GetImage(); !errors.Is(err, ErrImageOnDisk) {
+		t.Errorf("GetImage error %v, want ErrImageOnDisk", err)
+	}
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"math/rand/v2"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// ErrBadResult is returned by renderers of WorkPool when a tile is not valid (see validateTile),
+// or when a checked tile doesn't match its reference rendering. The worker should not be trusted anymore.
+var ErrBadResult = errors.New("bad tile")
+
+// Verification configures spot checks of tiles rendered by workers of WorkPool.
+// Checked tiles are rendered again by Reference, e.g. by the server itself, and compared pixel by pixel.
+// Density grids are sampled randomly, so they are not checked.
+type Verification struct {
+	// Rate is the fraction of tiles checked, from 0 to 1
+	Rate float64
+	// Tolerance is the maximal difference of a pixel's channel (in 16 bit units) not counted as a mismatch.
+	// Workers on different platforms may differ slightly, e.g. due to fused multiply-add.
+	Tolerance int
+	// MaxBadFraction is the fraction of mismatching pixels a tile may still have
+	MaxBadFraction float64
+	// Reference renders checked tiles
+	Reference api.Renderer
+}
+
+// validateTile returns error if tileImg rendered by a worker is not an image of the assigned tile.
+// Images are received from the network, so their bounds, stride and pixel buffer can be anything.
+func validateTile(tileImg *image.RGBA64, tile image.Rectangle) error {
+	if tileImg == nil {
+		return errors.New("no image")
+	}
+	if tileImg.Rect != tile {
+		return fmt.Errorf("bounds %s instead of %s", tileImg.Rect, tile)
+	}
+	if tileImg.Stride != 8*tile.Dx() {
+		return fmt.Errorf("stride %d instead of %d", tileImg.Stride, 8*tile.Dx())
+	}
+	if len(tileImg.Pix) != tileImg.Stride*tile.Dy() {
+		return fmt.Errorf("pixel buffer of %d bytes instead of %d", len(tileImg.Pix), tileImg.Stride*tile.Dy())
+	}
+	return nil
+}
+
+// compare returns error if tile differs from ref more than v allows.
+// Both images have to be valid images of the same tile (see validateTile).
+func (v *Verification) compare(tile, ref *image.RGBA64) error {
+	bad := 0
+	for y := tile.Rect.Min.Y; y < tile.Rect.Max.Y; y++ {
+		row := tile.Pix[tile.PixOffset(tile.Rect.Min.X, y):]
+		refRow := ref.Pix[ref.PixOffset(ref.Rect.Min.X, y):]
+		for x := 0; x < tile.Rect.Dx(); x++ {
+			// 4 big endian uint16 channels per pixel
+			for c := x * 8; c < x*8+8; c += 2 {
+				d := int(binary.BigEndian.Uint16(row[c:])) - int(binary.BigEndian.Uint16(refRow[c:]))
+				if d > v.Tolerance || -d > v.Tolerance {
+					bad++
+					break
+				}
+			}
+		}
+	}
+	total := tile.Rect.Dx() * tile.Rect.Dy()
+	if float64(bad) > v.MaxBadFraction*float64(total) {
+		return fmt.Errorf("%d of %d pixels differ", bad, total)
+	}
+	return nil
+}
+
+// worker wraps renderer added to WorkPool. It identifies the worker to the work sources,
+// validates its tiles and spot checks them, if the pool verifies results.
+type worker struct {
+	api.Renderer
+	id           uint64
+	verification *Verification // nil disables checks
+}
+
+// RenderTile implements api.Renderer
+func (w *worker) RenderTile(ctx context.Context, reg api.MandelRegion, params api.RenderParams, imgW, imgH int, tile image.Rectangle) (*image.RGBA64, error) {
+	tileImg, err := w.Renderer.RenderTile(ctx, reg, params, imgW, imgH, tile)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTile(tileImg, tile); err != nil {
+		return nil, fmt.Errorf("%w: tile %s: %w", ErrBadResult, tile, err)
+	}
+	if w.verification == nil || rand.Float64() >= w.verification.Rate {
+		return tileImg, nil
+	}
+
+	ref, err := w.verification.Reference.RenderTile(ctx, reg, params, imgW, imgH, tile)
+	if err != nil {
+		// failure of the reference is not the worker's fault
+		log.Printf("verification: reference render of tile %s: %v", tile, err)
+		return tileImg, nil
+	}
+	if err := validateTile(ref, tile); err != nil {
+		log.Printf("verification: reference render of tile %s: %v", tile, err)
+		return tileImg, nil
+	}
+	if err := w.verification.compare(tileImg, ref); err != nil {
+		return nil, fmt.Errorf("%w: tile %s doesn't match reference rendering: %w", ErrBadResult, tile, err)
+	}
+	return tileImg, nil
+}
+
+// WorkerID returns id of renderer given to work units by WorkPool, or 0 if it is unknown
+func WorkerID(renderer api.Renderer) uint64 {
+	if w, ok := renderer.(*worker); ok {
+		return w.id
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestValidateTile(t *testing.T) {
+	tile := image.Rect(64, 0, 128, 32)
+	big := image.NewRGBA64(image.Rect(0, 0, 128, 32))
+	short := image.NewRGBA64(tile)
+	short.Pix = short.Pix[:len(short.Pix)-1]
+
+	tests := []struct {
+		name    string
+		img     *image.RGBA64
+		wantErr bool
+	}{
+		{"valid", image.NewRGBA64(tile), false},
+		{"nil", nil, true},
+		{"other bounds", image.NewRGBA64(image.Rect(0, 0, 64, 32)), true},
+		{"sub image", big.SubImage(tile).(*image.RGBA64), true},
+		{"short pixel buffer", short, true},
+		{"empty", &image.RGBA64{Rect: tile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTile(tt.img, tile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTile() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerificationCompare(t *testing.T) {
+	tile := image.Rect(0, 64, 10, 74) // 100 pixels
+	ref := image.NewRGBA64(tile)
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			ref.SetRGBA64(x, y, color.RGBA64{R: uint16(x * 1000), G: uint16(y * 100), B: 30000, A: 0xffff})
+		}
+	}
+	// withDiffs returns copy of ref with n pixels' blue channel changed by d
+	withDiffs := func(n, d int) *image.RGBA64 {
+		img := image.NewRGBA64(tile)
+		copy(img.Pix, ref.Pix)
+		for i := 0; i < n; i++ {
+			x, y := tile.Min.X+i%tile.Dx(), tile.Min.Y+i/tile.Dx()
+			c := img.RGBA64At(x, y)
+			c.B = uint16(int(c.B) + d)
+			img.SetRGBA64(x, y, c)
+		}
+		return img
+	}
+
+	tests := []struct {
+		name    string
+		v       Verification
+		tile    *image.RGBA64
+		wantErr bool
+	}{
+		{"identical", Verification{}, withDiffs(0, 0), false},
+		{"one pixel differs", Verification{}, withDiffs(1, 1), true},
+		{"within tolerance", Verification{Tolerance: 2}, withDiffs(100, -2), false},
+		{"beyond tolerance", Verification{Tolerance: 2}, withDiffs(1, 3), true},
+		{"bad fraction allowed", Verification{MaxBadFraction: 0.05}, withDiffs(5, 1000), false},
+		{"bad fraction exceeded", Verification{MaxBadFraction: 0.05}, withDiffs(6, 1000), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.compare(tt.tile, ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compare() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
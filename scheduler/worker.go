@@ -0,0 +1,700 @@
+// Package scheduler splits rendering of images into tiles and hands them out as work to renderers.
+// It is used by the server to distribute work among connected clients,
+// and by the cli client to render locally with the very same tiling.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"maps"
+	"sync"
+
+	api "github.com/marben/irpc_dist_mandel"
+)
+
+// ImgWorkScheduler manages work on single mandelbrot image rendering
+// ImgWorkScheduler provides its image for api.ImgProvider and implements most of api.TileProvider
+// it hands out tiles as work for WorkPool's renderers
+type ImgWorkScheduler struct {
+	mRegion api.MandelRegion
+	params  api.RenderParams
+	store   TileStore // the "global" picture, 16 bits per channel
+
+	tileSize   int
+	tilesCount int
+	maxCopies  int // see DefaultMaxTileCopies
+
+	ctx       context.Context // done once the image is finished or cancelled
+	ctxCancel context.CancelFunc
+	cancelled bool
+
+	totalPixels    int
+	finishedPixels int
+
+	unstartedTiles map[image.Rectangle]struct{}
+	inProcessTiles map[image.Rectangle]struct{}
+	finishedTiles  map[image.Rectangle]struct{}
+	mergingTiles   map[image.Rectangle]struct{}     // tiles being written to the store by mergeTile, still unstarted or in process
+	renderedBy     map[image.Rectangle]uint64       // id of worker that rendered finished tile, see WorkerID
+	renders        map[image.Rectangle]*tileRenders // renders of tiles in process
+	stats          RenderStats
+	rendering      int           // renders in progress, including cancelled copies that didn't return yet
+	changed        chan struct{} // closed and replaced whenever a tile is merged
+	m              sync.Mutex
+
+	cache *TileCache // nil disables caching
+}
+
+// DefaultTileSize is the side of square tiles images are split into, unless configured otherwise
+const DefaultTileSize = 64
+
+// DefaultMaxTileCopies is how many workers render the same tile at once, unless configured otherwise.
+// Once there are no unstarted tiles, idle workers render tiles in process again, so that a slow worker doesn't hold up the image.
+// The first finished copy is merged and the others are cancelled.
+const DefaultMaxTileCopies = 2
+
+// tileRenders tracks copies of a tile being rendered
+type tileRenders struct {
+	ctx    context.Context // cancelled once a copy is merged
+	cancel context.CancelFunc
+	copies int
+}
+
+// RenderStats counts tile renders of a job, including the work wasted on duplicates
+type RenderStats struct {
+	Renders   int // renders of tiles, including failed and cancelled ones
+	Wasted    int // duplicates finished after the tile was already merged
+	Cancelled int // duplicates cancelled because another copy was merged
+}
+
+// NewImgWorkScheduler creates job rendering region into store, split into tileSize×tileSize tiles.
+// Up to maxCopies workers render the same tile at once (see DefaultMaxTileCopies), 1 disables duplicate renders.
+// Tiles found in cache are merged right away, so they are never handed out to workers.
+func NewImgWorkScheduler(store TileStore, region api.MandelRegion, params api.RenderParams, tileSize, maxCopies int, cache *TileCache) *ImgWorkScheduler {
+	allTilesSlice := SplitRectNoClip(store.bounds(), tileSize, tileSize)
+	allTiles := make(map[image.Rectangle]struct{}, len(allTilesSlice))
+	for _, t := range allTilesSlice {
+		allTiles[t] = struct{}{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	iws := &ImgWorkScheduler{
+		store:          store,
+		mRegion:        region,
+		params:         params,
+		unstartedTiles: allTiles,
+		tileSize:       tileSize,
+		tilesCount:     len(allTiles),
+		maxCopies:      max(maxCopies, 1),
+		inProcessTiles: make(map[image.Rectangle]struct{}),
+		finishedTiles:  make(map[image.Rectangle]struct{}, len(allTiles)),
+		mergingTiles:   make(map[image.Rectangle]struct{}),
+		renderedBy:     make(map[image.Rectangle]uint64),
+		renders:        make(map[image.Rectangle]*tileRenders),
+		changed:        make(chan struct{}),
+		totalPixels:    store.bounds().Dx() * store.bounds().Dy(),
+		ctx:            ctx,
+		ctxCancel:      cancel,
+		cache:          cache,
+	}
+	iws.loadCachedTiles()
+	return iws
+}
+
+// loadCachedTiles merges all unstarted tiles found in the cache
+func (iws *ImgWorkScheduler) loadCachedTiles() {
+	if iws.cache == nil {
+		return
+	}
+
+	loaded := 0
+	for tile := range iws.unstartedTiles {
+		key, err := iws.cacheKey(tile)
+		if err != nil {
+			// every tile of the job fails the same way
+			log.Printf("tile cache: disabled for the job: %v", err)
+			iws.cache = nil
+			return
+		}
+		tileImg, found := iws.cache.get(key, tile)
+		if !found {
+			continue
+		}
+		iws.m.Lock()
+		delete(iws.unstartedTiles, tile)
+		iws.inProcessTiles[tile] = struct{}{}
+		iws.m.Unlock()
+
+		if _, err := iws.mergeTile(tileImg, 0); err != nil {
+			log.Printf("tile cache: %v", err)
+			continue
+		}
+		loaded++
+	}
+	if loaded > 0 {
+		log.Printf("tile cache: %d/%d tiles loaded", loaded, iws.tilesCount)
+	}
+}
+
+// cacheKey returns key of tile in the tile cache
+func (iws *ImgWorkScheduler) cacheKey(tile image.Rectangle) (string, error) {
+	b := iws.store.bounds()
+	return tileCacheKey(iws.mRegion, iws.params, b.Dx(), b.Dy(), tile)
+}
+
+// FinishedTiles implements api.TileProvider
+// returns rectangles of tiles that are already rendered
+// (called by web client to figure out which tiles to download as image and display)
+func (iws *ImgWorkScheduler) FinishedTiles() (map[image.Rectangle]struct{}, error) {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	// copy is needed to because iws.finishedTiles is mutable
+	rtnMap := make(map[image.Rectangle]struct{}, len(iws.finishedTiles))
+	maps.Copy(rtnMap, iws.finishedTiles)
+
+	return rtnMap, nil
+}
+
+// FullImageDimensions implements api.TileProvider
+func (iws *ImgWorkScheduler) FullImageDimensions() (width int, height int, err error) {
+	b := iws.store.bounds()
+	return b.Dx(), b.Dy(), nil
+}
+
+// GetTileImg implements api.TileProvider
+// returns image of tileRect tile. returned image has same bounds as tileRect parameter,
+// so it can be directly copied onto the full image
+func (iws *ImgWorkScheduler) GetTileImg(tileRect image.Rectangle) (*image.RGBA, error) {
+	tileImg, err := iws.store.getTile(tileRect)
+	if err != nil {
+		return nil, fmt.Errorf("store.getTile: %w", err)
+	}
+	return CopyTile(tileImg, tileRect), nil
+}
+
+// TotalTilesCount implements [api.TileProvider].
+func (iws *ImgWorkScheduler) TotalTilesCount() (int, error) {
+	return iws.tilesCount, nil
+}
+
+// Frames implements [api.TileProvider].
+// Single image is a single frame.
+func (iws *ImgWorkScheduler) Frames() (current int, total int, err error) {
+	return 0, 1, nil
+}
+
+// PopWork implements WorkSource
+// unit of work is rendering of a single tile
+// Unstarted tiles are looked up in the cache first, as they may have been cached since the job started
+// (e.g. by another job of the same region). Those are merged instead of handed out.
+func (iws *ImgWorkScheduler) PopWork() (WorkUnit, bool) {
+	for {
+		tile, unstarted, found := iws.popTile()
+		if !found {
+			return nil, false
+		}
+		if unstarted && iws.mergeCachedTile(tile) {
+			continue
+		}
+		return func(ctx context.Context, renderer api.Renderer) error {
+			if _, err := iws.RenderTile(ctx, renderer, tile); err != nil {
+				return fmt.Errorf("render of tile %s failed: %w", tile, err)
+			}
+			log.Printf("rendered: %.2f%%", iws.finished()*100)
+			return nil
+		}, true
+	}
+}
+
+// mergeCachedTile merges popped tile from the cache.
+// It returns false if the tile isn't cached, so it has to be rendered.
+func (iws *ImgWorkScheduler) mergeCachedTile(tile image.Rectangle) bool {
+	if iws.cache == nil {
+		return false
+	}
+	key, err := iws.cacheKey(tile)
+	if err != nil {
+		return false
+	}
+	tileImg, found := iws.cache.get(key, tile)
+	if !found {
+		return false
+	}
+	if _, err := iws.mergeTile(tileImg, 0); err != nil && !errors.Is(err, errTileFinished) {
+		log.Printf("tile cache: %v", err)
+		return false
+	}
+	return true
+}
+
+// RenderTile renders tile handed out by PopUnstartedTile or PopInProcessTile using renderer,
+// merges it to the image and stores it to the cache.
+// Once a copy of the tile is merged, other copies being rendered are cancelled and their results are dropped.
+// Renders are cancelled as well when the job is cancelled (see Cancel), or when ctx of the worker is done.
+// completed is true if this tile completed the image
+// If the renderer fails, the tile is handed out again. If it failed verification (see ErrBadResult),
+// tiles it rendered before are rendered again too, unless the image is already finished.
+func (iws *ImgWorkScheduler) RenderTile(ctx context.Context, renderer api.Renderer, tile image.Rectangle) (completed bool, err error) {
+	r, found := iws.startRender(tile)
+	if !found {
+		// another worker was faster, before this copy even started
+		return false, nil
+	}
+	failed := false
+	defer func() { iws.endRender(tile, r, failed) }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(r.ctx, cancel)
+	defer stop()
+
+	b := iws.store.bounds()
+	tileImg, err := renderer.RenderTile(ctx, iws.mRegion, iws.params, b.Dx(), b.Dy(), tile)
+	if err != nil && !errors.Is(err, ErrBadResult) && r.ctx.Err() != nil {
+		// another worker was faster, or the image is finished or cancelled. Not a failure of the renderer.
+		// Bad tiles are failures even if they lost the race, so that the worker is dropped
+		iws.countDuplicate(&iws.stats.Cancelled)
+		return false, nil
+	}
+	if err != nil {
+		// tiles the worker rendered before are rejected by WorkPool, if the tile was bad
+		failed = true
+		return false, err
+	}
+	completed, err = iws.mergeTile(tileImg, WorkerID(renderer))
+	if errors.Is(err, errTileFinished) {
+		// another worker was faster
+		iws.countDuplicate(&iws.stats.Wasted)
+		return false, nil
+	}
+	if err != nil {
+		// not a failure of the renderer, so we keep it. The tile stays in process and is handed out again
+		log.Printf("merge tile %s: %v", tile, err)
+		return false, nil
+	}
+	if iws.cache != nil {
+		// failure to cache is not failure of the render
+		key, err := iws.cacheKey(tile)
+		if err == nil {
+			err = iws.cache.put(key, tileImg, WorkerID(renderer))
+		}
+		if err != nil {
+			log.Printf("tile cache: put tile %s: %v", tile, err)
+		}
+	}
+	return completed, nil
+}
+
+// startRender returns copies of popped tile, which already count this copy.
+// found is false if the tile was finished since it was popped.
+func (iws *ImgWorkScheduler) startRender(tile image.Rectangle) (r *tileRenders, found bool) {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	r = iws.renders[tile]
+	if r == nil {
+		return nil, false
+	}
+	iws.stats.Renders++
+	iws.rendering++
+	return r, true
+}
+
+// addCopy counts a new copy of tile being rendered
+// iws.m must be held
+func (iws *ImgWorkScheduler) addCopy(tile image.Rectangle) {
+	r := iws.renders[tile]
+	if r == nil {
+		ctx, cancel := context.WithCancel(iws.ctx)
+		r = &tileRenders{ctx: ctx, cancel: cancel}
+		iws.renders[tile] = r
+	}
+	r.copies++
+}
+
+// endRender uncounts a finished copy r of tile.
+// If the last copy failed, the tile is returned to unstarted tiles, so that it is handed out before the tiles in process.
+// Stats are logged once the last render of a finished image returns.
+func (iws *ImgWorkScheduler) endRender(tile image.Rectangle, r *tileRenders, failed bool) {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	iws.rendering--
+	if iws.rendering == 0 && iws.ctx.Err() != nil {
+		log.Printf("tile renders: %d, wasted duplicates: %d, cancelled duplicates: %d", iws.stats.Renders, iws.stats.Wasted, iws.stats.Cancelled)
+	}
+
+	r.copies--
+	if r.copies > 0 || iws.renders[tile] != r {
+		// other copies are still rendered, or the tile was merged
+		return
+	}
+	r.cancel()
+	delete(iws.renders, tile)
+	if _, found := iws.inProcessTiles[tile]; found && failed {
+		delete(iws.inProcessTiles, tile)
+		iws.unstartedTiles[tile] = struct{}{}
+	}
+}
+
+// countDuplicate increments counter of iws.stats
+func (iws *ImgWorkScheduler) countDuplicate(counter *int) {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+	*counter++
+}
+
+// Stats returns counts of renders of the image's tiles
+func (iws *ImgWorkScheduler) Stats() RenderStats {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+	return iws.stats
+}
+
+// RejectWorker implements WorkerRejecter. It hands out finished tiles rendered by worker id again.
+// Image that is already finished is kept as it is. Tiles in the cache are rejected by the cache itself.
+func (iws *ImgWorkScheduler) RejectWorker(id uint64) {
+	if id == 0 {
+		return
+	}
+
+	iws.m.Lock()
+	defer iws.m.Unlock()
+	if iws.ctx.Err() != nil {
+		return
+	}
+
+	var rejected []image.Rectangle
+	for tile, by := range iws.renderedBy {
+		if by != id {
+			continue
+		}
+		delete(iws.renderedBy, tile)
+		delete(iws.finishedTiles, tile)
+		iws.unstartedTiles[tile] = struct{}{}
+		iws.finishedPixels -= tile.Dx() * tile.Dy()
+		rejected = append(rejected, tile)
+	}
+	if len(rejected) == 0 {
+		return
+	}
+	log.Printf("verification: %d tiles of rejected worker are rendered again", len(rejected))
+	close(iws.changed)
+	iws.changed = make(chan struct{})
+}
+
+// popTile returns unstarted tile, or a tile in process if there is none. unstarted tells which one it is
+func (iws *ImgWorkScheduler) popTile() (tile image.Rectangle, unstarted, found bool) {
+	if tile, found = iws.PopUnstartedTile(); found {
+		return tile, true, true
+	}
+
+	// If there is no unstarted tile, we work again on a started one
+	tile, found = iws.PopInProcessTile()
+	return tile, false, found
+}
+
+// PopUnstartedTile returns tile that nobody works on yet and marks it as in process
+func (iws *ImgWorkScheduler) PopUnstartedTile() (tile image.Rectangle, found bool) {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	if iws.cancelled {
+		return image.Rectangle{}, false
+	}
+
+	// Get unstarted tile
+	if len(iws.unstartedTiles) > 0 {
+		for tile = range iws.unstartedTiles {
+			break
+		}
+		delete(iws.unstartedTiles, tile)
+
+		// Move popped tile to currently processed tiles
+		iws.inProcessTiles[tile] = struct{}{}
+		iws.addCopy(tile)
+		return tile, true
+	}
+
+	return image.Rectangle{}, false
+}
+
+// PopInProcessTile returns tile that is already being rendered by another worker.
+// The tile with the fewest copies being rendered is chosen. Tiles rendered by maxCopies workers are not returned.
+func (iws *ImgWorkScheduler) PopInProcessTile() (tile image.Rectangle, found bool) {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	if iws.cancelled {
+		return image.Rectangle{}, false
+	}
+	copies := iws.maxCopies
+	for t := range iws.inProcessTiles {
+		n := 0
+		if r := iws.renders[t]; r != nil {
+			n = r.copies
+		}
+		if n < copies {
+			tile, copies, found = t, n, true
+		}
+	}
+	if found {
+		iws.addCopy(tile)
+	}
+	return tile, found
+}
+
+// ErrCancelled is returned for images of cancelled jobs, see ImgWorkScheduler.Cancel
+var ErrCancelled = errors.New("job cancelled")
+
+// Cancel stops rendering of unfinished image. Its tiles are not handed out anymore and renders in progress are cancelled.
+// Done is closed, GetImage and GetImageRows return ErrCancelled.
+func (iws *ImgWorkScheduler) Cancel() {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	if iws.ctx.Err() != nil {
+		// finished or cancelled already
+		return
+	}
+	iws.cancelled = true
+	iws.ctxCancel()
+	close(iws.changed)
+	iws.changed = make(chan struct{})
+}
+
+// Cancelled returns true if the job was cancelled
+func (iws *ImgWorkScheduler) Cancelled() bool {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+	return iws.cancelled
+}
+
+// ErrImageOnDisk is returned by GetImage of images kept in DiskTileStore, which may not fit into memory.
+// They are received by GetImageRows or saved by SavePNGWhenRendered instead.
+var ErrImageOnDisk = errors.New("image is kept on disk, receive it by rows")
+
+// GetImage matches api.ImgProvider for this job
+// blocks until the picture is fully rendered
+// the whole picture is read from the store, so images of DiskTileStore return ErrImageOnDisk
+func (iws *ImgWorkScheduler) GetImage() (*image.RGBA64, error) {
+	if _, onDisk := iws.store.(*DiskTileStore); onDisk {
+		return nil, ErrImageOnDisk
+	}
+	<-iws.ctx.Done() // wait for render to finish
+	if iws.Cancelled() {
+		return nil, ErrCancelled
+	}
+	return iws.store.getTile(iws.store.bounds())
+}
+
+// CloseStore closes the image's store, if it is DiskTileStore. The image can't be read afterwards.
+func (iws *ImgWorkScheduler) CloseStore() error {
+	if diskStore, onDisk := iws.store.(*DiskTileStore); onDisk {
+		return diskStore.Close()
+	}
+	return nil
+}
+
+// Progress matches api.ImgProvider for this job
+func (iws *ImgWorkScheduler) Progress() (float64, error) {
+	return float64(iws.finished()), nil
+}
+
+// GetImageRows matches api.ImgProvider for this job
+// rows are returned as soon as all tiles covering them are finished
+func (iws *ImgWorkScheduler) GetImageRows(ctx context.Context, y, n int) (*image.RGBA64, error) {
+	rows := RowsRect(iws.store.bounds(), y, n)
+	if rows.Empty() {
+		return nil, fmt.Errorf("rows %d..%d out of image %s", y, y+n-1, iws.store.bounds())
+	}
+
+	for {
+		iws.m.Lock()
+		rendered := iws.rendered(rows)
+		changed := iws.changed
+		cancelled := iws.cancelled
+		iws.m.Unlock()
+
+		if cancelled {
+			return nil, ErrCancelled
+		}
+		if rendered {
+			return iws.store.getTile(rows)
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Done is closed once the image is finished or cancelled
+func (iws *ImgWorkScheduler) Done() <-chan struct{} {
+	return iws.ctx.Done()
+}
+
+// rendered returns true if no unfinished tile overlaps rect
+// iws.m must be held
+func (iws *ImgWorkScheduler) rendered(rect image.Rectangle) bool {
+	for _, tiles := range []map[image.Rectangle]struct{}{iws.unstartedTiles, iws.inProcessTiles} {
+		for tile := range tiles {
+			if tile.Overlaps(rect) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SavePNGWhenRendered waits for the picture and streams it to filename as 16 bit png
+func (iws *ImgWorkScheduler) SavePNGWhenRendered(filename string) {
+	<-iws.ctx.Done()
+	if iws.Cancelled() {
+		return
+	}
+
+	log.Printf("saving %q", filename)
+	if err := savePNGStream(filename, iws.store); err != nil {
+		log.Printf("save %q: %v", filename, err)
+		return
+	}
+	log.Printf("image saved to %q", filename)
+}
+
+// errTileFinished is returned by mergeTile for tiles that are already finished, or being merged from another copy
+var errTileFinished = errors.New("tile is already finished")
+
+// mergeTile writes the provided tileImg rendered by worker id (0 if unknown) to the store
+// and marks that tile as finished
+// returns true if the merged tile completed the image
+// tileImg has to be a valid image (see validateTile) of one of the image's tiles, which isn't finished yet.
+func (iws *ImgWorkScheduler) mergeTile(tileImg *image.RGBA64, id uint64) (completed bool, err error) {
+	// tileImg tile contains global coordinates
+	// so we use them directly to write to the big picture
+	dstRect := tileImg.Bounds()
+
+	// the tile is reserved, so that only a single copy is ever written to the store.
+	// Copies may differ, e.g. if a worker is malicious, and renderedBy has to name the worker whose pixels are in the image.
+	// rescheduled tile may be finished by a worker it was handed out to before, so it may be unstarted too
+	iws.m.Lock()
+	_, inProcess := iws.inProcessTiles[dstRect]
+	_, unstarted := iws.unstartedTiles[dstRect]
+	_, finished := iws.finishedTiles[dstRect]
+	_, merging := iws.mergingTiles[dstRect]
+	if !finished && !merging && (inProcess || unstarted) {
+		iws.mergingTiles[dstRect] = struct{}{}
+	}
+	iws.m.Unlock()
+	if finished || merging {
+		return false, errTileFinished
+	}
+	if !inProcess && !unstarted {
+		return false, fmt.Errorf("%s is not a tile of the image", dstRect)
+	}
+
+	err = iws.store.putTile(tileImg)
+
+	iws.m.Lock()
+	defer iws.m.Unlock()
+
+	delete(iws.mergingTiles, dstRect)
+	if err != nil {
+		// tile stays in process, so that it is rendered again
+		return false, fmt.Errorf("store.putTile: %w", err)
+	}
+	iws.finishedPixels += dstRect.Dx() * dstRect.Dy()
+
+	delete(iws.inProcessTiles, tileImg.Rect)
+	delete(iws.unstartedTiles, tileImg.Rect)
+	iws.finishedTiles[tileImg.Rect] = struct{}{}
+	if r := iws.renders[tileImg.Rect]; r != nil {
+		// cancels the other copies. Copies of the tile handed out again (see RejectWorker) get new context
+		r.cancel()
+		delete(iws.renders, tileImg.Rect)
+	}
+	if id != 0 {
+		iws.renderedBy[tileImg.Rect] = id
+	} else {
+		delete(iws.renderedBy, tileImg.Rect)
+	}
+
+	close(iws.changed)
+	iws.changed = make(chan struct{})
+
+	if len(iws.unstartedTiles) == 0 && len(iws.inProcessTiles) == 0 && iws.ctx.Err() == nil {
+		iws.ctxCancel()
+		return true, nil
+	}
+	return false, nil
+}
+
+// finished returns fraction of finished tiles
+func (iws *ImgWorkScheduler) finished() float32 {
+	iws.m.Lock()
+	defer iws.m.Unlock()
+	return float32(iws.finishedPixels) / float32(iws.totalPixels)
+}
+
+// CopyTile returns copy of tileRect part of img, reduced to 8 bits per channel.
+// Returned image has the same bounds as tileRect.
+func CopyTile(img *image.RGBA64, tileRect image.Rectangle) *image.RGBA {
+	tileImg := image.NewRGBA(tileRect)
+	for y := 0; y < tileRect.Dy(); y++ {
+		srcY := tileRect.Min.Y + y
+		src := img.Pix[img.PixOffset(tileRect.Min.X, srcY):]
+		dst := tileImg.Pix[y*tileImg.Stride:]
+
+		// RGBA64 stores big endian uint16 per channel, so the high byte is the 8 bit value
+		for i := range tileRect.Dx() * 4 {
+			dst[i] = src[i*2]
+		}
+	}
+	return tileImg
+}
+
+// SplitRectNoClip splits r into tiles of size tileW × tileH.
+// Tiles at the right and bottom edges are smaller if r is not divisible.
+func SplitRectNoClip(r image.Rectangle, tileW, tileH int) []image.Rectangle {
+	if tileW <= 0 || tileH <= 0 {
+		panic("tile dimensions must be positive")
+	}
+
+	w := r.Dx()
+	h := r.Dy()
+
+	var tiles []image.Rectangle
+
+	for oy := 0; oy < h; oy += tileH {
+		th := tileH
+		if oy+th > h {
+			th = h - oy
+		}
+
+		for ox := 0; ox < w; ox += tileW {
+			tw := tileW
+			if ox+tw > w {
+				tw = w - ox
+			}
+
+			tile := image.Rect(
+				r.Min.X+ox,
+				r.Min.Y+oy,
+				r.Min.X+ox+tw,
+				r.Min.Y+oy+th,
+			)
+			tiles = append(tiles, tile)
+		}
+	}
+
+	return tiles
+}
+
+// RowsRect returns rectangle of rows y..y+n-1 of bounds, clipped to bounds
+func RowsRect(bounds image.Rectangle, y, n int) image.Rectangle {
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+n).Intersect(bounds)
+}